@@ -13,67 +13,6 @@ import (
 	"github.com/tomyl/xui"
 )
 
-const (
-	timeFormat = "15:04"
-	helptext   = `mört - a simple task manager and time tracker
-
-Global keybindings
-==================
-
-F1      This help screen.
-F2      Task screen.
-F3      Timesheet screen.
-Ctrl-C  Exit mort.
-Ctrl-G  Cancel current operation.
-Ctrl-L  Redraw screen.
-
-Task view keybindings
-=====================
-
-Ctrl-N  Create new task.
-Enter   Edit selected task.
-/       Search task titles.
-s       Search task bodies.
-
-w       Toggle between day and week view.
-Left    Go to previous day/week.
-Right   Go to next day/week.
-
-Ctrl-T  Toggle todo state of selected task.
-t       Toggle display of todo tasks.
-Ctrl-X  Toggle archive status of selected task.
-x       Toggle display of archived tasks.
-p       Toggle project filter.
-q       Reset filters.
-
-Ctrl-I  Clock in on selected task.
-Ctrl-O  Clock out from currently active task.
-i       Jump to active task.
-
-Timesheet view keybindings
-==========================
-
-w       Toggle between day and week view.
-Left    Go to previous day/week.
-Right   Go to next day/week.
-
-i       Edit clockin time.
-o       Edit clockout time.
-`
-)
-
-var todoStates = []string{"TODO", "WAIT", "DONE"}
-var todoColors = []string{"\033[31m", "\033[33m", "\033[32m"}
-
-func getStateIndex(state string) int {
-	for i := range todoStates {
-		if todoStates[i] == state {
-			return i
-		}
-	}
-	return -1
-}
-
 type restart struct {
 	f              func(restart)
 	task           *store.Task
@@ -81,6 +20,9 @@ type restart struct {
 	tmpl           string
 	focus          string
 	timesheetIndex int
+
+	// draft is set if the draft of task was saved by the internal editor.
+	draft bool
 }
 
 func (r restart) Error() string {
@@ -93,36 +35,55 @@ type mortApp struct {
 
 	help      *xui.ListWidget
 	tasks     *tasksWidget
+	preview   *previewWidget
+	board     *boardWidget
+	projects  *projectsWidget
+	views     *viewsWidget
 	timesheet *timesheetWidget
+	editor    *editorWidget
 	status    *xui.TextWidget
 	prompt    *xui.TextWidget
 
-	Range          store.TimeRange
-	FilterArchived bool
-	FilterTitle    string
-	FilterBody     string
-	FilterRange    bool
-	FilterProject  string
-	FilterParentID int64
-	FilterTodo     bool
+	// showPreview splits the tasks screen to show the selected task.
+	showPreview bool
+
+	// undo and redo are stacks of changes, see change.
+	undo []undoEntry
+	redo []undoEntry
+
+	// edit is the body being edited in the internal editor, if any.
+	edit *editSession
+
+	// viewName is the name of the last recalled or saved view.
+	viewName string
+
+	Range  store.TimeRange
+	Filter store.TaskQuery
 }
 
 func newMortApp(db *store.Store) *mortApp {
+	statusFg, statusBg := conf.theme.attributes("status")
 
 	app := &mortApp{
 		db:        db,
 		help:      &xui.ListWidget{},
 		tasks:     &tasksWidget{},
+		preview:   &previewWidget{},
+		board:     &boardWidget{},
+		projects:  &projectsWidget{},
+		views:     &viewsWidget{},
 		timesheet: &timesheetWidget{},
+		editor:    &editorWidget{},
 		status: &xui.TextWidget{
-			FgColor: gocui.ColorWhite,
-			BgColor: gocui.ColorBlue,
+			FgColor: statusFg,
+			BgColor: statusBg,
 		},
-		prompt: &xui.TextWidget{},
+		prompt:      &xui.TextWidget{},
+		showPreview: conf.Preview.Show,
 	}
 
 	app.Range.Today()
-	app.help.SetModel(strings.Split(helptext, "\n"))
+	app.help.SetModel(helpLines())
 
 	return app
 }
@@ -152,6 +113,9 @@ func (app *mortApp) runOnce(state restart) error {
 
 	defer g.Close()
 
+	// Esc would otherwise wait for the next key to tell it from Alt.
+	g.InputEsc = conf.Edit.Vi
+
 	app.gx = xui.New(g)
 
 	g.SetManagerFunc(xui.ResizeLayout(app.layout))
@@ -179,6 +143,7 @@ func (app *mortApp) runOnce(state restart) error {
 			log.Println(err)
 			app.prompt.SetText(err.Error())
 		}
+		app.updatePreview()
 		return nil
 	})
 
@@ -186,13 +151,22 @@ func (app *mortApp) runOnce(state restart) error {
 		app.loadTasks()
 		if len(app.tasks.Model()) == 0 {
 			app.gx.Focus(app.help.View())
-			app.status.SetText("Help")
+			app.setStatus("Help")
 		} else {
-			app.gx.Focus(app.tasks.View())
+			app.focusTasks()
 			if state.task != nil {
 				app.tasks.SetCurrentByTaskID(state.task.ID)
 			}
-			app.setMessage("Press F1 for help.")
+			if len(conf.warnings) > 0 {
+				app.setMessage("Config warning: %s", conf.warnings[0])
+			} else {
+				app.setMessage("Press %s for help.", keyHint("app.help"))
+			}
+		}
+	} else if state.focus == "board" {
+		app.showBoardView()
+		if state.task != nil {
+			app.board.SetCurrentByTaskID(state.task.ID)
 		}
 	} else {
 		app.gx.FocusName(state.focus)
@@ -207,8 +181,31 @@ func (app *mortApp) layout(g *gocui.Gui) error {
 	status := xui.Region{0, -2, -1, -2}
 	prompt := xui.Region{0, -1, -1, -1}
 
+	// The editor is created first so that it stays below the other screens
+	// until it's focused.
+	app.editor.SetView(app.gx.SetRegionView("editor", center))
 	app.help.SetView(app.gx.SetRegionView("help", center))
-	app.tasks.SetView(app.gx.SetRegionView("tasks", center))
+
+	if app.showPreview {
+		maxX, _ := g.Size()
+		split := maxX * (100 - conf.Preview.Width) / 100
+		tasks := center
+		tasks.Right = split - 1
+		preview := center
+		preview.Left = split
+		app.tasks.SetView(app.gx.SetRegionView("tasks", tasks))
+		app.preview.SetView(app.gx.SetRegionView("preview", preview))
+	} else {
+		if err := g.DeleteView("preview"); err != nil && err != gocui.ErrUnknownView {
+			return err
+		}
+		app.preview.SetView(nil)
+		app.tasks.SetView(app.gx.SetRegionView("tasks", center))
+	}
+
+	app.board.SetView(app.gx.SetRegionView("board", center))
+	app.projects.SetView(app.gx.SetRegionView("projects", center))
+	app.views.SetView(app.gx.SetRegionView("views", center))
 	app.timesheet.SetView(app.gx.SetRegionView("timesheet", center))
 	app.status.SetView(app.gx.SetRegionView("status", status))
 	app.prompt.SetView(app.gx.SetRegionView("prompt", prompt))
@@ -216,175 +213,70 @@ func (app *mortApp) layout(g *gocui.Gui) error {
 	return app.gx.Err()
 }
 
-func (app *mortApp) registerKeys(g *gocui.Gui) error {
-	// Global
-	app.gx.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, xui.ErrorHandler(gocui.ErrQuit))
-
-	app.gx.SetKeybinding("", gocui.KeyCtrlG, gocui.ModNone, xui.Handler(func() {
-	}))
-
-	app.gx.SetKeybinding("", gocui.KeyCtrlL, gocui.ModNone, xui.Handler(func() {
-		app.layout(g)
-	}))
-
-	app.gx.SetKeybinding("", gocui.KeyF1, gocui.ModNone, xui.Handler(app.showHelpView))
-	app.gx.SetKeybinding("", '1', gocui.ModNone, xui.Handler(app.showHelpView))
-
-	app.gx.SetKeybinding("", gocui.KeyF2, gocui.ModNone, xui.Handler(app.showTasksView))
-	app.gx.SetKeybinding("", '2', gocui.ModNone, xui.Handler(app.showTasksView))
-
-	app.gx.SetKeybinding("", gocui.KeyF3, gocui.ModNone, xui.Handler(app.showTimesheetView))
-	app.gx.SetKeybinding("", '3', gocui.ModNone, xui.Handler(app.showTimesheetView))
-
-	// Tasks
-	app.gx.SetWidgetAction(app.tasks, gocui.KeyArrowUp, gocui.ModNone, xui.ActionPreviousLine)
-	app.gx.SetWidgetAction(app.tasks, gocui.KeyArrowDown, gocui.ModNone, xui.ActionNextLine)
-	app.gx.SetWidgetAction(app.tasks, gocui.KeyPgup, gocui.ModNone, xui.ActionPreviousPage)
-	app.gx.SetWidgetAction(app.tasks, gocui.KeyPgdn, gocui.ModNone, xui.ActionNextPage)
-
-	app.gx.SetKeybinding("tasks", gocui.KeyArrowLeft, gocui.ModNone, xui.Handler(func() {
-		app.Range.Prev()
-		app.loadTasks()
-	}))
-
-	app.gx.SetKeybinding("tasks", gocui.KeyArrowRight, gocui.ModNone, xui.Handler(func() {
-		app.Range.Next()
-		app.loadTasks()
-	}))
-
-	app.gx.SetKeybinding("tasks", gocui.KeyEnter, gocui.ModNone, app.editCurrentTask)
-
-	app.gx.SetKeybinding("tasks", 'd', gocui.ModNone, xui.Handler(func() {
-		app.toggleParentFilter()
-		app.loadTasks()
-	}))
-
-	app.gx.SetKeybinding("tasks", gocui.KeyCtrlI, gocui.ModNone, xui.Handler(func() {
-		app.clockIn()
-	}))
-
-	app.gx.SetKeybinding("tasks", 'i', gocui.ModNone, xui.Handler(func() {
-		app.goToActive()
-	}))
-
-	app.gx.SetKeybinding("tasks", gocui.KeyCtrlL, gocui.ModNone, xui.Handler(func() {
-		app.loadTasks()
-	}))
-
-	app.gx.SetKeybinding("tasks", gocui.KeyCtrlN, gocui.ModNone, app.newTask)
+func (app *mortApp) showHelpView() {
+	app.gx.Focus(app.help.View())
+	app.setStatus("Help")
+}
 
-	app.gx.SetKeybinding("tasks", gocui.KeyCtrlO, gocui.ModNone, xui.Handler(func() {
-		app.clockOut()
-	}))
+func (app *mortApp) showTasksView() {
+	app.focusTasks()
+	app.loadTasks()
+}
 
-	app.gx.SetKeybinding("tasks", 'p', gocui.ModNone, xui.Handler(func() {
-		app.toggleProjectFilter()
-		app.loadTasks()
-	}))
+// focusTasks shows the tasks screen, including the preview pane if enabled.
+func (app *mortApp) focusTasks() {
+	if app.showPreview {
+		app.gx.SetViewOnTop("preview")
+	}
+	app.gx.Focus(app.tasks.View())
+}
 
-	app.gx.SetKeybinding("tasks", 'q', gocui.ModNone, xui.Handler(func() {
-		app.resetFilters()
-	}))
+// togglePreview shows or hides the preview pane.
+func (app *mortApp) togglePreview(g *gocui.Gui) error {
+	app.showPreview = !app.showPreview
 
-	app.gx.SetKeybinding("tasks", 's', gocui.ModNone, xui.Handler(func() {
-		callback := func(success bool, response string) {
-			if success {
-				app.setBodyFilter(response)
-			} else {
-				app.setMessage("Cancelled.")
-			}
-		}
+	if err := app.layout(g); err != nil {
+		return err
+	}
 
-		app.prompt.SetPrompt(g, "Search body: ", "", callback)
-	}))
+	if g.CurrentView() == app.tasks.View() {
+		app.focusTasks()
+	}
 
-	app.gx.SetKeybinding("tasks", gocui.KeyCtrlT, gocui.ModNone, xui.Handler(func() {
-		app.toggleTodoState()
-	}))
+	app.updatePreview()
 
-	app.gx.SetKeybinding("tasks", 't', gocui.ModNone, xui.Handler(func() {
-		app.FilterTodo = !app.FilterTodo
-		app.loadTasks()
-	}))
+	return app.gx.Err()
+}
 
-	app.gx.SetKeybinding("tasks", 'v', gocui.ModNone, xui.Handler(func() {
-		app.openCurrentTask()
-	}))
+// updatePreview shows the selected task in the preview pane. The scroll
+// position is kept unless the task changed.
+func (app *mortApp) updatePreview() {
+	if !app.showPreview {
+		return
+	}
 
-	app.gx.SetKeybinding("tasks", 'w', gocui.ModNone, xui.Handler(func() {
-		app.toggleTasksDateRange()
-		app.loadTasks()
-	}))
+	task := app.tasks.CurrentTask()
 
-	app.gx.SetWidgetKeybinding(app.tasks, gocui.KeyCtrlX, gocui.ModNone, app.toggleArchived)
+	if task == nil {
+		app.preview.SetModel(nil)
+		return
+	}
 
-	app.gx.SetKeybinding("tasks", 'x', gocui.ModNone, xui.Handler(func() {
-		app.FilterArchived = !app.FilterArchived
-		app.loadTasks()
-	}))
+	var parent *store.Task
 
-	app.gx.SetKeybinding("tasks", '/', gocui.ModNone, xui.Handler(func() {
-		callback := func(success bool, response string) {
-			if success {
-				app.setTitleFilter(response)
-			} else {
-				app.setMessage("Cancelled.")
-			}
+	if task.ParentID != nil {
+		if idx := app.tasks.GetTaskIndexByID(*task.ParentID); idx >= 0 {
+			parent = &app.tasks.Model()[idx]
+		} else if t, err := app.db.GetTaskByID(*task.ParentID); err == nil {
+			parent = t
 		}
+	}
 
-		app.prompt.SetPrompt(g, "Search title: ", "", callback)
-	}))
-
-	// Timesheet
-	app.gx.SetWidgetAction(app.timesheet, gocui.KeyArrowUp, gocui.ModNone, xui.ActionPreviousLine)
-	app.gx.SetWidgetAction(app.timesheet, gocui.KeyArrowDown, gocui.ModNone, xui.ActionNextLine)
-	app.gx.SetWidgetAction(app.timesheet, gocui.KeyPgup, gocui.ModNone, xui.ActionPreviousPage)
-	app.gx.SetWidgetAction(app.timesheet, gocui.KeyPgdn, gocui.ModNone, xui.ActionNextPage)
-
-	app.gx.SetKeybinding("timesheet", gocui.KeyArrowLeft, gocui.ModNone, xui.Handler(func() {
-		app.Range.Prev()
-		app.loadTimesheet()
-	}))
-
-	app.gx.SetKeybinding("timesheet", gocui.KeyArrowRight, gocui.ModNone, xui.Handler(func() {
-		app.Range.Next()
-		app.loadTimesheet()
-	}))
-
-	app.gx.SetKeybinding("timesheet", gocui.KeyEnter, gocui.ModNone, app.editCurrentTimesheetTask)
-
-	app.gx.SetKeybinding("timesheet", 'i', gocui.ModNone, xui.Handler(func() {
-		app.editClockin(g)
-	}))
-
-	app.gx.SetKeybinding("timesheet", 'o', gocui.ModNone, xui.Handler(func() {
-		app.editClockout(g)
-	}))
-
-	app.gx.SetKeybinding("timesheet", gocui.KeyCtrlL, gocui.ModNone, xui.Handler(func() {
-		app.loadTimesheet()
-	}))
-
-	app.gx.SetKeybinding("timesheet", 'v', gocui.ModNone, xui.Handler(func() {
-		app.openCurrentTimesheetTask()
-	}))
-
-	app.gx.SetKeybinding("timesheet", 'w', gocui.ModNone, xui.Handler(func() {
-		app.toggleTimesheetDateRange()
-		app.loadTimesheet()
-	}))
-
-	return app.gx.Err()
-}
-
-func (app *mortApp) showHelpView() {
-	app.gx.Focus(app.help.View())
-	app.status.SetText("Help")
-}
+	lines := formatPreview(task, parent)
 
-func (app *mortApp) showTasksView() {
-	app.gx.Focus(app.tasks.View())
-	app.loadTasks()
+	if strings.Join(lines, "\n") != strings.Join(app.preview.lines, "\n") {
+		app.preview.SetModel(lines)
+	}
 }
 
 func (app *mortApp) showTimesheetView() {
@@ -392,24 +284,26 @@ func (app *mortApp) showTimesheetView() {
 	app.loadTimesheet()
 }
 
+// setStatus shows msg in the status bar, prefixed with the profile name or
+// local for a per-directory database.
+func (app *mortApp) setStatus(msg string) {
+	name := app.db.Profile()
+	if app.db.Local() != "" {
+		name = "local"
+	}
+	app.status.SetText("[" + name + "] " + msg)
+}
+
 func (app *mortApp) setMessage(pat string, params ...interface{}) {
 	msg := fmt.Sprintf(pat, params...)
 	app.prompt.SetText(msg)
 }
 
 func (app *mortApp) loadTasks() error {
-	query := store.TaskQuery{
-		Archived:    app.FilterArchived,
-		SearchTitle: app.FilterTitle,
-		SearchBody:  app.FilterBody,
-		Project:     app.FilterProject,
-		ParentID:    app.FilterParentID,
-		Todo:        app.FilterTodo,
-	}
-
-	if app.FilterRange {
-		query.Range = &app.Range
-	}
+	query := app.Filter
+	query.Spent = true
+	query.SpentRange = app.Filter.Range
+	query.Descendants = app.tasks.Tree()
 
 	current := app.tasks.CurrentTask()
 	tasks, err := app.db.GetTasks(query)
@@ -418,92 +312,206 @@ func (app *mortApp) loadTasks() error {
 		return err
 	}
 
+	app.tasks.SetRangeSpent(query.SpentRange != nil)
 	app.tasks.SetModel(tasks)
 
 	if current != nil {
 		app.tasks.SetCurrentByTaskID(current.ID)
 	}
 
+	app.updatePreview()
+
 	app.showTasksQuery()
 
 	return nil
 }
 
+// resetFilters clears the task filters and the search. Todo mode and the sort
+// order are kept.
 func (app *mortApp) resetFilters() {
-	app.FilterArchived = false
-	app.FilterTitle = ""
-	app.FilterBody = ""
-	app.FilterRange = false
-	app.FilterProject = ""
-	app.FilterParentID = 0
+	app.Filter = store.TaskQuery{
+		Todo:    app.Filter.Todo,
+		Sort:    app.Filter.Sort,
+		Reverse: app.Filter.Reverse,
+	}
+	app.tasks.SetPattern("")
 	app.loadTasks()
 }
 
 func (app *mortApp) showTasksQuery() {
 	var msg string
-	if app.FilterTodo {
-		msg = fmt.Sprintf("%d todo tasks", len(app.tasks.model))
+	if app.Filter.Todo {
+		msg = fmt.Sprintf("%d todo tasks", len(app.tasks.Matching()))
 	} else {
-		msg = fmt.Sprintf("%d tasks", len(app.tasks.model))
+		msg = fmt.Sprintf("%d tasks", len(app.tasks.Matching()))
 	}
-	filters := make([]string, 0)
-	if !app.FilterArchived {
-		filters = append(filters, "Archived hidden")
+	if app.tasks.Tree() {
+		msg += " (tree)"
 	}
-	if app.FilterProject != "" {
-		filters = append(filters, "Project="+app.FilterProject)
+	if marked := len(app.tasks.Marked()); marked > 0 {
+		msg += fmt.Sprintf(", %d marked", marked)
 	}
-	if app.FilterParentID != 0 {
-		filters = append(filters, fmt.Sprintf("Parent=%d", app.FilterParentID))
+
+	sort, desc := app.Filter.SortOrder()
+	if app.Filter.Todo && app.Filter.Sort == "" {
+		sort = "state, " + sort
 	}
-	if app.FilterRange {
-		filters = append(filters, fmt.Sprintf("Date=%s", app.Range.String()))
+	if desc {
+		msg += " by " + sort + " ↓"
+	} else {
+		msg += " by " + sort + " ↑"
 	}
-	if app.FilterTitle != "" {
-		filters = append(filters, fmt.Sprintf("Title=*%s*", app.FilterTitle))
+
+	// The sort order is already shown.
+	query := app.Filter
+	query.Sort = ""
+	query.Reverse = false
+
+	if s := query.String(); s != "" {
+		msg += " | " + s
 	}
-	if app.FilterBody != "" {
-		filters = append(filters, fmt.Sprintf("Body=*%s*", app.FilterBody))
+	if pattern := app.tasks.Pattern(); pattern != "" {
+		msg += fmt.Sprintf(" | search:%q", pattern)
 	}
-	if len(filters) > 0 {
-		msg += " | " + strings.Join(filters, " ")
+	app.setStatus(msg)
+}
+
+// sortCycle is the order in which the tasks screen cycles through sort
+// fields.
+var sortCycle = []string{"updated", "created", "scheduled", "project", "state", "title", "spent"}
+
+// cycleSort sorts tasks by the next field in sortCycle.
+func (app *mortApp) cycleSort() {
+	current, _ := app.Filter.SortOrder()
+	next := sortCycle[0]
+
+	for i, name := range sortCycle {
+		if name == current {
+			next = sortCycle[(i+1)%len(sortCycle)]
+		}
+	}
+
+	app.Filter.Sort = next
+	app.Filter.Reverse = false
+	app.loadTasks()
+}
+
+func (app *mortApp) editQuery(g *gocui.Gui) {
+	callback := func(success bool, response string) {
+		if !success {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		if err := app.setQuery(response); err != nil {
+			app.setMessage("Invalid query: %v", err)
+		}
+	}
+
+	app.prompt.SetPrompt(g, "Query: ", app.Filter.String(), callback)
+}
+
+// setQuery replaces the task filters with a query in the syntax of
+// store.ParseQuery.
+func (app *mortApp) setQuery(s string) error {
+	query, err := store.ParseQuery(s)
+
+	if err != nil {
+		return err
+	}
+
+	if query.Range != nil {
+		app.Range = *query.Range
+		query.Range = &app.Range
+	}
+
+	app.Filter = query
+
+	return app.loadTasks()
+}
+
+// selectedTasks returns the marked tasks, or the task under the cursor if no
+// task is marked.
+func (app *mortApp) selectedTasks() []store.Task {
+	if marked := app.tasks.Marked(); len(marked) > 0 {
+		return marked
+	}
+
+	if task := app.tasks.CurrentTask(); task != nil {
+		return []store.Task{*task}
 	}
-	app.status.SetText(msg)
+
+	return nil
+}
+
+func taskIDs(tasks []store.Task) []int64 {
+	ids := make([]int64, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+	}
+	return ids
+}
+
+// pluralTasks returns e.g. "1 task" or "3 tasks".
+func pluralTasks(n int) string {
+	if n == 1 {
+		return "1 task"
+	}
+	return fmt.Sprintf("%d tasks", n)
+}
+
+// describeTasks returns e.g. "#3" or "3 tasks" for messages.
+func describeTasks(tasks []store.Task) string {
+	if len(tasks) == 1 {
+		return fmt.Sprintf("#%d", tasks[0].ID)
+	}
+	return pluralTasks(len(tasks))
 }
 
+// toggleArchived archives the selected tasks, or unarchives them if they are
+// all archived. Archived tasks stay visible until the list is reloaded.
 func (app *mortApp) toggleArchived() error {
-	task := app.tasks.CurrentTask()
+	tasks := app.selectedTasks()
 
-	if task == nil {
+	if len(tasks) == 0 {
 		return errors.New("no task")
 	}
 
-	var err error
-	if task.ArchivedAt != nil {
-		err = app.db.SetArchived(task.ID, false)
-	} else {
-		err = app.db.SetArchived(task.ID, true)
+	archive := false
+	for _, task := range tasks {
+		if task.ArchivedAt == nil {
+			archive = true
+		}
 	}
 
-	if err != nil {
-		return err
+	desc := "unarchive " + describeTasks(tasks)
+	if archive {
+		desc = "archive " + describeTasks(tasks)
 	}
 
-	task, err = app.refreshTask(task.ID)
+	err := app.change(desc, taskIDs(tasks), func() error {
+		return app.db.SetArchivedTasks(taskIDs(tasks), archive)
+	})
 
 	if err != nil {
 		return err
 	}
 
-	if task != nil {
-		app.tasks.render()
-		if task.ArchivedAt != nil {
-			app.setMessage("Archived")
-		} else {
-			app.setMessage("Unarchived")
+	for _, task := range tasks {
+		if _, err := app.refreshTask(task.ID); err != nil {
+			return err
 		}
 	}
 
+	app.tasks.ClearMarks()
+	app.showTasksQuery()
+
+	if archive {
+		app.setMessage("Archived %s.", pluralTasks(len(tasks)))
+	} else {
+		app.setMessage("Unarchived %s.", pluralTasks(len(tasks)))
+	}
+
 	return nil
 }
 
@@ -517,7 +525,14 @@ func (app *mortApp) refreshTask(id int64) (*store.Task, error) {
 			return nil, err
 		}
 
+		if app.Filter.Range != nil {
+			if task.RangeSpent, err = app.db.GetRangeSpent(id, *app.Filter.Range); err != nil {
+				return nil, err
+			}
+		}
+
 		app.tasks.SetTaskAt(idx, task)
+		app.updatePreview()
 
 		return task, nil
 	}
@@ -525,23 +540,100 @@ func (app *mortApp) refreshTask(id int64) (*store.Task, error) {
 	return nil, nil
 }
 
-func (app *mortApp) setTitleFilter(needle string) error {
-	app.FilterTitle = needle
-	return app.loadTasks()
+// searchTitle narrows the task list while a fuzzy search pattern is typed,
+// see tasksWidget.SetPattern. Up and Down select tasks meanwhile. Cancelling
+// restores the previous pattern.
+func (app *mortApp) searchTitle(g *gocui.Gui) {
+	const prefix = "Search: "
+	old := app.tasks.Pattern()
+
+	callback := func(success bool, response string) {
+		if success {
+			app.tasks.SetPattern(response)
+		} else {
+			app.tasks.SetPattern(old)
+			app.setMessage("Cancelled.")
+		}
+		app.showTasksQuery()
+		app.updatePreview()
+	}
+
+	app.prompt.SetPrompt(g, prefix, old, callback)
+
+	view := app.prompt.View()
+
+	if view == nil || view.Editor == nil {
+		return
+	}
+
+	edit := view.Editor
+
+	view.Editor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) bool {
+		switch key {
+		case gocui.KeyArrowUp:
+			app.tasks.HandleAction(xui.ActionPreviousLine)
+			app.updatePreview()
+			return true
+		case gocui.KeyArrowDown:
+			app.tasks.HandleAction(xui.ActionNextLine)
+			app.updatePreview()
+			return true
+		}
+
+		consumed := edit.Edit(v, key, ch, mod)
+
+		// The prompt is no longer editable once it is done or cancelled.
+		if v.Editable {
+			line := strings.SplitN(v.Buffer(), "\n", 2)[0]
+			pattern := ""
+			if len(line) > len(prefix) {
+				pattern = strings.TrimSpace(line[len(prefix):])
+			}
+			app.tasks.SetPattern(pattern)
+			app.showTasksQuery()
+			app.updatePreview()
+		}
+
+		return consumed
+	})
+}
+
+func (app *mortApp) searchBody(g *gocui.Gui) {
+	callback := func(success bool, response string) {
+		if success {
+			app.setBodyFilter(response)
+		} else {
+			app.setMessage("Cancelled.")
+		}
+	}
+
+	app.prompt.SetPrompt(g, "Search body: ", "", callback)
 }
 
 func (app *mortApp) setBodyFilter(needle string) error {
-	app.FilterBody = needle
+	app.Filter.SearchBody = needle
 	return app.loadTasks()
 }
 
 func (app *mortApp) newTask(g *gocui.Gui, view *gocui.View) error {
 	log.Printf("new task")
-	return restart{f: app.createTask}
+	return app.captureTask(g, 0)
+}
+
+// newSubtask creates a child task of the selected task.
+func (app *mortApp) newSubtask(g *gocui.Gui) error {
+	task := app.getCurrentTask()
+
+	if task == nil {
+		return nil
+	}
+
+	log.Printf("new subtask of %d", task.ID)
+	return app.captureTask(g, task.ID)
 }
 
 func (app *mortApp) createTask(cmd restart) {
-	body, err := store.GetDraft(0, true)
+	body, err := app.db.GetDraft(0, true)
 
 	if err != nil {
 		app.setMessage("Failed to get draft: %v", err)
@@ -553,6 +645,12 @@ func (app *mortApp) createTask(cmd restart) {
 		return
 	}
 
+	app.saveNewTask(cmd.parentID, body)
+}
+
+// saveNewTask creates a task, or a subtask of parentID if positive, and
+// clears the draft.
+func (app *mortApp) saveNewTask(parentID int64, body string) {
 	if body == "" {
 		app.setMessage("Empty content.")
 		return
@@ -563,20 +661,36 @@ func (app *mortApp) createTask(cmd restart) {
 	payload.Project = store.GetProjectFromTitle(payload.Title)
 	payload.Body = body
 
-	if cmd.parentID > 0 {
-		payload.ParentID = &cmd.parentID
+	if parentID > 0 {
+		payload.ParentID = &parentID
+	}
+
+	before, err := app.db.Snapshot(nil)
+
+	if err != nil {
+		app.setMessage("Failed to store task: %v", err)
+		return
 	}
 
-	_, err = app.db.CreateTask(payload)
+	id, err := app.db.CreateTask(payload)
 
 	if err != nil {
 		app.setMessage("Failed to store task: %v", err)
 		return
 	}
 
-	store.SetDraft(0, "")
+	if err := app.recordChange(fmt.Sprintf("create #%d", id), before, []int64{id}); err != nil {
+		log.Println(err)
+	}
+
+	app.db.SetDraft(0, "")
 	app.resetFilters()
-	app.setMessage("Created task.")
+
+	if parentID > 0 {
+		app.setMessage("Created subtask.")
+	} else {
+		app.setMessage("Created task.")
+	}
 }
 
 func (app *mortApp) editCurrentTask(g *gocui.Gui, view *gocui.View) error {
@@ -587,7 +701,7 @@ func (app *mortApp) editCurrentTask(g *gocui.Gui, view *gocui.View) error {
 		return nil
 	}
 
-	return restart{f: app.editTask, task: task}
+	return app.editTaskBody(g, restart{f: app.editTask, task: task})
 }
 
 func (app *mortApp) getCurrentTask() *store.Task {
@@ -604,7 +718,7 @@ func (app *mortApp) getCurrentTask() *store.Task {
 func (app *mortApp) editCurrentTimesheetTask(g *gocui.Gui, view *gocui.View) error {
 	task := app.getCurrentTimesheetTask()
 
-	if task != nil {
+	if task == nil {
 		return nil
 	}
 
@@ -614,12 +728,12 @@ func (app *mortApp) editCurrentTimesheetTask(g *gocui.Gui, view *gocui.View) err
 		focus = g.CurrentView().Name()
 	}
 
-	return restart{
+	return app.editTaskBody(g, restart{
 		f:              app.editTask,
 		task:           task,
 		focus:          focus,
 		timesheetIndex: app.timesheet.Current(),
-	}
+	})
 }
 
 func (app *mortApp) getCurrentTimesheetTask() *store.Task {
@@ -645,69 +759,132 @@ func (app *mortApp) getCurrentTimesheetTask() *store.Task {
 	return task
 }
 
+// editTask edits the body of r.task in the external editor.
 func (app *mortApp) editTask(r restart) {
 	task := r.task
-	store.SetDraft(task.ID, task.Body)
-	body, err := store.GetDraft(task.ID, false)
+
+	if !r.draft {
+		app.db.SetDraft(task.ID, task.Body)
+	}
+
+	body, err := app.db.GetDraft(task.ID, false)
 
 	if err != nil {
 		app.setMessage("Failed to get draft: %v", err)
 		return
 	}
 
-	if body == "" {
-		app.setMessage("Empty body.")
+	app.saveTaskBody(task, body)
+}
+
+// cycleTodoState moves the selected task step states forward (or backward if
+// negative) in its project's workflow.
+func (app *mortApp) cycleTodoState(step int) {
+	task := app.tasks.CurrentTask()
+
+	if task == nil {
+		app.setMessage("No task.")
 		return
 	}
 
-	if body == task.Body {
-		app.setMessage("No change.")
-		return
+	w := getWorkflow(task.Project)
+	idx := -1
+
+	if task.State != nil {
+		idx = w.stateIndex(*task.State)
 	}
 
-	var payload store.Task
-	payload.Title = store.GetTitleFromBody(body)
-	payload.Project = store.GetProjectFromTitle(payload.Title)
-	payload.Body = body
+	newStateIdx := w.next(idx, step)
+	newState := ""
 
-	if err := app.db.UpdateTaskByID(task.ID, payload); err != nil {
-		app.setMessage("Failed to update task: %v", task)
-		return
+	if newStateIdx >= 0 {
+		newState = w.States[newStateIdx].Name
 	}
 
-	app.resetFilters()
-	app.setMessage("Updated task.")
+	app.setTodoState(task, newState)
 }
 
-func (app *mortApp) toggleTodoState() {
-	task := app.tasks.CurrentTask()
+// editTodoState prompts for the state of the selected tasks. The state must
+// be in the workflow of every task.
+func (app *mortApp) editTodoState(g *gocui.Gui) {
+	tasks := app.selectedTasks()
 
-	if task == nil {
+	if len(tasks) == 0 {
 		app.setMessage("No task.")
 		return
 	}
 
-	newStateIdx := 0
-	newState := todoStates[newStateIdx]
+	w := getWorkflow(tasks[0].Project)
 
-	if task.State != nil {
-		idx := getStateIndex(*task.State)
-		if idx >= 0 {
-			if idx < len(todoStates)-1 {
-				newStateIdx = idx + 1
-				newState = todoStates[newStateIdx]
-			} else {
-				newState = ""
+	callback := func(success bool, response string) {
+		if !success {
+			return
+		}
+
+		name := strings.ToUpper(strings.TrimSpace(response))
+		idxs := make([]int, len(tasks))
+
+		for i, task := range tasks {
+			idxs[i] = -1
+
+			if name == "" || name == "NONE" {
+				continue
 			}
+
+			tw := getWorkflow(task.Project)
+
+			if tw.stateIndex(name) < 0 {
+				app.setMessage("Unknown state %q for #%d, expected one of %s or none.", response, task.ID, strings.Join(tw.stateNames(), ", "))
+				return
+			}
+
+			idxs[i] = stateRank(name)
 		}
+
+		if name == "NONE" {
+			name = ""
+		}
+
+		if len(tasks) == 1 && len(app.tasks.Marked()) == 0 {
+			app.setTodoState(&tasks[0], name)
+			return
+		}
+
+		err := app.change("set state of "+describeTasks(tasks), taskIDs(tasks), func() error {
+			return app.db.SetTodoStates(taskIDs(tasks), idxs, name)
+		})
+
+		if err != nil {
+			app.setMessage("Failed to set state: %s", err)
+			return
+		}
+
+		app.tasks.ClearMarks()
+		app.loadTasks()
+		app.setMessage("Changed state of %s.", pluralTasks(len(tasks)))
+	}
+
+	prefix := fmt.Sprintf("State (%s, none): ", strings.Join(w.stateNames(), ", "))
+
+	if len(tasks) > 1 {
+		prefix = fmt.Sprintf("State of %s (%s, none): ", pluralTasks(len(tasks)), strings.Join(w.stateNames(), ", "))
 	}
 
-	if err := app.db.SetTodoState(task.ID, newStateIdx, newState); err != nil {
-		app.setMessage("Failed to toggle state: %s", err)
+	app.prompt.SetPrompt(g, prefix, "", callback)
+}
+
+// setTodoState sets the state of a task, or clears it if state is empty.
+func (app *mortApp) setTodoState(task *store.Task, state string) {
+	err := app.change(fmt.Sprintf("set state of #%d", task.ID), []int64{task.ID}, func() error {
+		return app.db.SetTodoState(task.ID, stateRank(state), state)
+	})
+
+	if err != nil {
+		app.setMessage("Failed to set state: %s", err)
 		return
 	}
 
-	task, err := app.refreshTask(task.ID)
+	task, err = app.refreshTask(task.ID)
 
 	if err != nil {
 		return
@@ -720,6 +897,229 @@ func (app *mortApp) toggleTodoState() {
 	app.setMessage("")
 }
 
+// editProject prompts for a project to move the selected tasks to.
+func (app *mortApp) editProject(g *gocui.Gui) {
+	tasks := app.selectedTasks()
+
+	if len(tasks) == 0 {
+		app.setMessage("No task.")
+		return
+	}
+
+	callback := func(success bool, response string) {
+		if !success {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		project := strings.TrimSpace(response)
+
+		if strings.ContainsAny(project, ":\n") {
+			app.setMessage("Invalid project %q.", project)
+			return
+		}
+
+		err := app.change("set project of "+describeTasks(tasks), taskIDs(tasks), func() error {
+			return app.db.SetProjects(taskIDs(tasks), project)
+		})
+
+		if err != nil {
+			app.setMessage("Failed to set project: %v", err)
+			return
+		}
+
+		app.tasks.ClearMarks()
+		app.loadTasks()
+		if project == "" || project == "default" {
+			app.setMessage("Removed project of %s.", pluralTasks(len(tasks)))
+		} else {
+			app.setMessage("Moved %s to project %s.", pluralTasks(len(tasks)), project)
+		}
+	}
+
+	project := ""
+	if len(tasks) == 1 && tasks[0].Project != "default" {
+		project = tasks[0].Project
+	}
+
+	prefix := fmt.Sprintf("Project of %s (empty for none): ", pluralTasks(len(tasks)))
+	app.prompt.SetPrompt(g, prefix, project, callback)
+}
+
+// deleteTasks asks for confirmation and deletes the selected tasks.
+func (app *mortApp) deleteTasks(g *gocui.Gui) {
+	tasks := app.selectedTasks()
+
+	if len(tasks) == 0 {
+		app.setMessage("No task.")
+		return
+	}
+
+	callback := func(success bool, response string) {
+		if !success || strings.ToLower(strings.TrimSpace(response)) != "y" {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		err := app.change("delete "+describeTasks(tasks), taskIDs(tasks), func() error {
+			return app.db.DeleteTasks(taskIDs(tasks))
+		})
+
+		if err != nil {
+			app.setMessage("Failed to delete: %v", err)
+			return
+		}
+
+		log.Printf("Deleted tasks %v", taskIDs(tasks))
+
+		app.tasks.ClearMarks()
+		app.loadTasks()
+		app.setMessage("Deleted %s.", pluralTasks(len(tasks)))
+	}
+
+	what := pluralTasks(len(tasks))
+	if len(tasks) == 1 {
+		what = fmt.Sprintf("#%d %s", tasks[0].ID, tasks[0].Title)
+	}
+
+	app.prompt.SetPrompt(g, fmt.Sprintf("Delete %s? (y/n): ", what), "", callback)
+}
+
+// editParent prompts for a task (id or title search) to move the selected
+// task under.
+func (app *mortApp) editParent(g *gocui.Gui) {
+	task := app.getCurrentTask()
+
+	if task == nil {
+		return
+	}
+
+	callback := func(success bool, response string) {
+		response = strings.TrimSpace(response)
+
+		if !success || response == "" {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		tasks, err := matchTasks(app.db, response)
+
+		if err != nil {
+			app.setMessage("Failed to find task: %v", err)
+			return
+		}
+
+		switch len(tasks) {
+		case 0:
+			app.setMessage("No task matching %q.", response)
+			return
+		case 1:
+		default:
+			matches := make([]string, 0, len(tasks))
+			for _, t := range tasks {
+				matches = append(matches, fmt.Sprintf("#%d %s", t.ID, t.Title))
+			}
+			app.setMessage("%d tasks match: %s", len(tasks), strings.Join(matches, ", "))
+			return
+		}
+
+		parent := tasks[0]
+
+		err = app.change(fmt.Sprintf("move #%d", task.ID), []int64{task.ID}, func() error {
+			return app.db.SetParent(task.ID, parent.ID)
+		})
+
+		if err != nil {
+			app.setMessage("Failed to move task: %v", err)
+			return
+		}
+
+		app.loadTasks()
+		app.setMessage("Moved under #%d %s.", parent.ID, parent.Title)
+	}
+
+	app.prompt.SetPrompt(g, "Move under (id or search): ", "", callback)
+}
+
+// detachTask makes the selected task a top-level task.
+func (app *mortApp) detachTask() {
+	task := app.getCurrentTask()
+
+	if task == nil {
+		return
+	}
+
+	if task.ParentID == nil {
+		app.setMessage("No parent.")
+		return
+	}
+
+	err := app.change(fmt.Sprintf("detach #%d", task.ID), []int64{task.ID}, func() error {
+		return app.db.SetParent(task.ID, 0)
+	})
+
+	if err != nil {
+		app.setMessage("Failed to detach task: %v", err)
+		return
+	}
+
+	app.loadTasks()
+	app.setMessage("Detached task.")
+}
+
+func (app *mortApp) editEstimate(g *gocui.Gui) {
+	task := app.getCurrentTask()
+
+	if task == nil {
+		return
+	}
+
+	estimate := ""
+	if task.Estimate != nil {
+		estimate = formatDuration(time.Duration(*task.Estimate) * time.Second)
+	}
+
+	callback := func(success bool, response string) {
+		if !success {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		var d time.Duration
+		if response != "" {
+			var err error
+			if d, err = parseDuration(response); err != nil {
+				app.setMessage("Invalid estimate: %v", err)
+				return
+			}
+		}
+
+		err := app.change(fmt.Sprintf("set estimate of #%d", task.ID), []int64{task.ID}, func() error {
+			return app.db.SetEstimate(task.ID, d)
+		})
+
+		if err != nil {
+			app.setMessage("Failed to set estimate: %v", err)
+			return
+		}
+
+		if _, err := app.refreshTask(task.ID); err != nil {
+			app.setMessage("Failed to load task: %v", err)
+			return
+		}
+
+		app.tasks.render()
+
+		if d > 0 {
+			app.setMessage("Estimated %s.", formatDuration(d))
+		} else {
+			app.setMessage("Cleared estimate.")
+		}
+	}
+
+	app.prompt.SetPrompt(g, "Estimate: ", estimate, callback)
+}
+
 func (app *mortApp) clockIn() {
 	task := app.tasks.CurrentTask()
 
@@ -728,7 +1128,11 @@ func (app *mortApp) clockIn() {
 		return
 	}
 
-	if err := app.db.Clockin(task.ID); err != nil {
+	err := app.change(fmt.Sprintf("clock in #%d", task.ID), []int64{task.ID}, func() error {
+		return app.db.Clockin(task.ID)
+	})
+
+	if err != nil {
 		app.setMessage("Failed to clock in: %s", err)
 		return
 	}
@@ -750,7 +1154,9 @@ func (app *mortApp) clockOut() {
 		return
 	}
 
-	if err := app.db.Clockout(); err != nil {
+	err = app.change(fmt.Sprintf("clock out #%d", taskID), []int64{taskID}, app.db.Clockout)
+
+	if err != nil {
 		app.setMessage("Failed to clock out: %s", err)
 		return
 	}
@@ -772,6 +1178,7 @@ func (app *mortApp) goToActive() {
 		return
 	}
 
+	app.tasks.Reveal(taskID)
 	idx := app.tasks.GetTaskIndexByID(taskID)
 
 	if idx < 0 {
@@ -801,18 +1208,18 @@ func (app *mortApp) showTimesheetQuery() {
 	if len(filters) > 0 {
 		msg += " filter:" + strings.Join(filters, ",")
 	}
-	app.status.SetText(msg)
+	app.setStatus(msg)
 }
 
 func (app *mortApp) toggleTasksDateRange() {
-	if app.FilterRange {
+	if app.Filter.Range != nil {
 		if app.Range.Days <= 1 {
 			app.Range.Week()
 		} else {
-			app.FilterRange = false
+			app.Filter.Range = nil
 		}
 	} else {
-		app.FilterRange = true
+		app.Filter.Range = &app.Range
 		app.Range.Today()
 	}
 }
@@ -876,17 +1283,26 @@ func (app *mortApp) timesheetEdit(entry *store.TimesheetEntry, s string, clockin
 		entry.ClockoutAt = &t
 	}
 
-	if err := app.db.UpdateTimesheet(entry.ID, &entry.ClockinAt, entry.ClockoutAt); err != nil {
+	desc := fmt.Sprintf("edit clock-out of #%d", entry.TaskID)
+	if clockin {
+		desc = fmt.Sprintf("edit clock-in of #%d", entry.TaskID)
+	}
+
+	err := app.change(desc, []int64{entry.TaskID}, func() error {
+		return app.db.UpdateTimesheet(entry.ID, &entry.ClockinAt, entry.ClockoutAt)
+	})
+
+	if err != nil {
 		app.setMessage("Failed to update timesheet: %v", err)
 	}
 }
 
 func toTime(t time.Time) string {
-	return t.Local().Format(timeFormat)
+	return t.Local().Format(conf.Formats.Time)
 }
 
 func (app *mortApp) toggleProjectFilter() {
-	if app.FilterProject == "" {
+	if app.Filter.Project == "" {
 		task := app.tasks.CurrentTask()
 		if task == nil {
 			app.setMessage("No task.")
@@ -896,27 +1312,95 @@ func (app *mortApp) toggleProjectFilter() {
 			app.setMessage("No project.")
 			return
 		}
-		app.FilterProject = task.Project
+		app.Filter.Project = task.Project
 	} else {
-		app.FilterProject = ""
+		app.Filter.Project = ""
 	}
 }
 
 func (app *mortApp) toggleParentFilter() {
-	if app.FilterParentID <= 0 {
+	if app.Filter.ParentID <= 0 {
 		task := app.tasks.CurrentTask()
 		if task == nil {
 			app.setMessage("No task.")
 			return
 		}
 		if task.ParentID != nil {
-			app.FilterParentID = *task.ParentID
+			app.Filter.ParentID = *task.ParentID
 		} else {
-			app.FilterParentID = task.ID
+			app.Filter.ParentID = task.ID
 		}
 	} else {
-		app.FilterParentID = 0
+		app.Filter.ParentID = 0
+	}
+}
+
+// editProfile prompts for a profile to switch to.
+func (app *mortApp) editProfile(g *gocui.Gui) {
+	profiles, err := store.Profiles()
+
+	if err != nil {
+		app.setMessage("Failed to list profiles: %v", err)
+		return
+	}
+
+	callback := func(success bool, response string) {
+		if !success {
+			return
+		}
+
+		name := strings.TrimSpace(response)
+
+		if name == "" || name == app.db.Profile() {
+			return
+		}
+
+		if err := app.switchProfile(name); err != nil {
+			app.setMessage("Failed to switch profile: %v", err)
+			return
+		}
+
+		app.setMessage("Switched to profile %s.", name)
+	}
+
+	prefix := fmt.Sprintf("Profile (%s): ", strings.Join(profiles, ", "))
+	app.prompt.SetPrompt(g, prefix, "", callback)
+}
+
+// switchProfile replaces the database and log with those of another profile.
+func (app *mortApp) switchProfile(name string) error {
+	if err := store.CheckProfileName(name); err != nil {
+		return err
+	}
+
+	db, err := openStore(name)
+
+	if err != nil {
+		return err
+	}
+
+	if err := openLog(db); err != nil {
+		db.Close()
+		return err
 	}
+
+	app.db.Close()
+	app.db = db
+	app.clearUndo()
+	app.Filter = store.TaskQuery{Todo: app.Filter.Todo}
+	app.viewName = ""
+
+	// Marks and collapsed tasks refer to task IDs of the other database.
+	app.tasks.ClearMarks()
+	app.tasks.ExpandAll()
+	app.tasks.SetPattern("")
+
+	log.Printf("Switched to profile %s", name)
+
+	app.loadTimesheet()
+	app.showTasksView()
+
+	return nil
 }
 
 func (app *mortApp) openCurrentTask() {
@@ -936,12 +1420,12 @@ func (app *mortApp) openCurrentTimesheetTask() {
 }
 
 func (app *mortApp) openTask(task *store.Task) {
-	cmd := exec.Command("open-mort", task.Title)
+	cmd := exec.Command(conf.OpenCommand, task.Title)
 
 	if err := cmd.Run(); err != nil {
-		app.setMessage("Failed to execute open-mort: %v", err)
+		app.setMessage("Failed to execute %s: %v", conf.OpenCommand, err)
 		return
 	}
 
-	app.setMessage("Executed open-mort.")
+	app.setMessage("Executed %s.", conf.OpenCommand)
 }
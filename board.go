@@ -0,0 +1,483 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xui"
+)
+
+// A boardColumn holds the cards of one todo state. The empty state holds the
+// tasks without state.
+type boardColumn struct {
+	state string
+	tasks []store.Task
+
+	// offset is the first visible card.
+	offset int
+}
+
+// title returns the column header.
+func (c *boardColumn) title() string {
+	if c.state == "" {
+		return "no state"
+	}
+	return c.state
+}
+
+// boardWidget shows tasks as cards in one column per todo state.
+type boardWidget struct {
+	view    *gocui.View
+	columns []boardColumn
+
+	// col and row select a card.
+	col int
+	row int
+}
+
+func (w *boardWidget) View() *gocui.View {
+	return w.view
+}
+
+func (w *boardWidget) SetView(view *gocui.View) {
+	if view != nil {
+		view.Wrap = false
+	}
+	w.view = view
+	w.render()
+}
+
+// SetModel distributes tasks over one column per state, followed by columns
+// for other states of tasks and a column for tasks without state. The order
+// of tasks is kept within each column, and so are the selection and the
+// scroll positions.
+func (w *boardWidget) SetModel(tasks []store.Task, states []string) {
+	current := w.CurrentTask()
+	offsets := make(map[string]int)
+	index := make(map[string]int)
+
+	for _, c := range w.columns {
+		offsets[c.state] = c.offset
+	}
+
+	w.columns = nil
+
+	add := func(state string) {
+		if _, ok := index[state]; !ok {
+			index[state] = len(w.columns)
+			w.columns = append(w.columns, boardColumn{state: state, offset: offsets[state]})
+		}
+	}
+
+	for _, state := range states {
+		add(state)
+	}
+
+	for _, task := range tasks {
+		if task.State != nil {
+			add(*task.State)
+		}
+	}
+
+	add("")
+
+	for _, task := range tasks {
+		state := ""
+		if task.State != nil {
+			state = *task.State
+		}
+		c := &w.columns[index[state]]
+		c.tasks = append(c.tasks, task)
+	}
+
+	for i := range w.columns {
+		if c := &w.columns[i]; c.offset >= len(c.tasks) {
+			c.offset = 0
+		}
+	}
+
+	if current == nil || !w.SetCurrentByTaskID(current.ID) {
+		w.clamp()
+	}
+
+	w.render()
+}
+
+// Columns returns the columns of the board.
+func (w *boardWidget) Columns() []boardColumn {
+	return w.columns
+}
+
+// CurrentColumn returns the selected column or nil if there are no columns.
+func (w *boardWidget) CurrentColumn() *boardColumn {
+	if w.col < len(w.columns) {
+		return &w.columns[w.col]
+	}
+	return nil
+}
+
+// CurrentTask returns the selected card or nil if the selected column is
+// empty.
+func (w *boardWidget) CurrentTask() *store.Task {
+	if c := w.CurrentColumn(); c != nil && w.row < len(c.tasks) {
+		return &c.tasks[w.row]
+	}
+	return nil
+}
+
+// SetCurrentByTaskID selects the card of a task and reports whether it was
+// found.
+func (w *boardWidget) SetCurrentByTaskID(id int64) bool {
+	for col := range w.columns {
+		for row, task := range w.columns[col].tasks {
+			if task.ID == id {
+				w.col, w.row = col, row
+				w.clamp()
+				w.render()
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MoveColumn selects the card at the same row step columns to the right, or
+// to the left if negative.
+func (w *boardWidget) MoveColumn(step int) {
+	w.col += step
+	w.clamp()
+	w.render()
+}
+
+// MoveRow selects the card step rows down, or up if negative.
+func (w *boardWidget) MoveRow(step int) {
+	w.row += step
+	w.clamp()
+	w.render()
+}
+
+// clamp keeps the selection within the board and scrolls the selected column
+// so that the selected card is visible.
+func (w *boardWidget) clamp() {
+	if w.col >= len(w.columns) {
+		w.col = len(w.columns) - 1
+	}
+
+	if w.col < 0 {
+		w.col = 0
+	}
+
+	c := w.CurrentColumn()
+
+	if c == nil {
+		w.row = 0
+		return
+	}
+
+	if w.row >= len(c.tasks) {
+		w.row = len(c.tasks) - 1
+	}
+
+	if w.row < 0 {
+		w.row = 0
+	}
+
+	if w.view != nil {
+		_, sy := w.view.Size()
+		// The first line holds the column headers.
+		if rows := sy - 1; rows > 0 && w.row >= c.offset+rows {
+			c.offset = w.row - rows + 1
+		}
+	}
+
+	if w.row < c.offset {
+		c.offset = w.row
+	}
+}
+
+func (w *boardWidget) render() {
+	view := w.view
+
+	if view == nil {
+		return
+	}
+
+	view.Clear()
+
+	if len(w.columns) == 0 {
+		return
+	}
+
+	sx, sy := view.Size()
+	n := len(w.columns)
+
+	// Columns are separated by a vertical line.
+	width := (sx - (n - 1)) / n
+
+	if width < 1 {
+		return
+	}
+
+	t := conf.theme
+	lines := make([]string, sy)
+
+	for col := range w.columns {
+		c := &w.columns[col]
+
+		for i := range lines {
+			if col > 0 {
+				lines[i] += "│"
+			}
+
+			if i == 0 {
+				header := truncateWidth(fmt.Sprintf("%s (%d)", c.title(), len(c.tasks)), width)
+				attr := t.ansi(style{Bold: true})
+				if c.state != "" {
+					attr += t.stateStyle("", c.state)
+				}
+				lines[i] += attr + xui.Pad(header, width) + ansiReset
+				continue
+			}
+
+			row := c.offset + i - 1
+
+			if row >= len(c.tasks) {
+				lines[i] += strings.Repeat(" ", width)
+				continue
+			}
+
+			task := &c.tasks[row]
+			card := xui.Pad(truncateWidth(fmt.Sprintf("#%d %s", task.ID, task.Title), width), width)
+			attr := ""
+
+			if task.ClockinAt != nil {
+				attr = t.style("active")
+			} else if task.ArchivedAt != nil {
+				attr = t.style("archived")
+			}
+
+			if col == w.col && row == w.row {
+				attr += t.style("selection")
+			}
+
+			lines[i] += attr + card + ansiReset
+		}
+	}
+
+	fmt.Fprint(view, strings.Join(lines, "\n"))
+}
+
+func (app *mortApp) showBoardView() {
+	app.gx.Focus(app.board.View())
+	app.loadBoard()
+}
+
+// loadBoard fills the board with the tasks matching the task filters, in
+// state order. The columns follow the workflow of the filtered project.
+func (app *mortApp) loadBoard() {
+	query := app.Filter
+	query.Sort = "state"
+	query.Reverse = false
+
+	tasks, err := app.db.GetTasks(query)
+
+	if err != nil {
+		app.setMessage("Failed to load tasks: %v", err)
+		return
+	}
+
+	app.board.SetModel(tasks, getWorkflow(app.Filter.Project).stateNames())
+
+	msg := fmt.Sprintf("Board of %s", pluralTasks(len(tasks)))
+
+	query.Sort = ""
+
+	if s := query.String(); s != "" {
+		msg += " | " + s
+	}
+
+	app.setStatus(msg)
+}
+
+// moveCard moves the selected card step columns to the right, or to the left
+// if negative, by changing its todo state. Columns with states that aren't in
+// the workflow of the task are skipped. The card is put first in the column.
+func (app *mortApp) moveCard(step int) {
+	task := app.board.CurrentTask()
+
+	if task == nil {
+		app.setMessage("No task.")
+		return
+	}
+
+	columns := app.board.Columns()
+	w := getWorkflow(task.Project)
+	col := app.board.col
+	idx := -1
+
+	for {
+		col += step
+
+		if col < 0 || col >= len(columns) {
+			app.setMessage("No other state in the workflow of #%d in that direction.", task.ID)
+			return
+		}
+
+		if columns[col].state == "" {
+			idx = -1
+			break
+		}
+
+		if w.stateIndex(columns[col].state) >= 0 {
+			idx = stateRank(columns[col].state)
+			break
+		}
+	}
+
+	target := columns[col]
+	moved := *task
+	moved.State = &target.state
+	stateIdx := idx * store.StateStride
+	moved.StateIdx = &stateIdx
+	tasks := append([]store.Task{moved}, target.tasks...)
+
+	if idx >= 0 {
+		var err error
+		if tasks, err = app.columnOrder(target.state, tasks); err != nil {
+			app.setMessage("Failed to move task: %v", err)
+			return
+		}
+	}
+
+	err := app.change(fmt.Sprintf("move #%d to %s", task.ID, target.title()), taskIDs(tasks), func() error {
+		if err := app.db.SetTodoState(task.ID, idx, target.state); err != nil {
+			return err
+		}
+		if idx < 0 {
+			return nil
+		}
+		return app.reorderCards(tasks)
+	})
+
+	if err != nil {
+		app.setMessage("Failed to move task: %v", err)
+		return
+	}
+
+	app.loadBoard()
+	app.board.SetCurrentByTaskID(moved.ID)
+}
+
+// moveCardWithinColumn moves the selected card step rows down, or up if
+// negative.
+func (app *mortApp) moveCardWithinColumn(step int) {
+	task := app.board.CurrentTask()
+
+	if task == nil {
+		app.setMessage("No task.")
+		return
+	}
+
+	c := app.board.CurrentColumn()
+
+	if c.state == "" {
+		app.setMessage("Tasks without state can't be reordered.")
+		return
+	}
+
+	row := app.board.row
+	other := row + step
+
+	if other < 0 || other >= len(c.tasks) {
+		return
+	}
+
+	tasks := append([]store.Task{}, c.tasks...)
+	tasks[row], tasks[other] = tasks[other], tasks[row]
+	moved := tasks[other].ID
+
+	tasks, err := app.columnOrder(c.state, tasks)
+
+	if err != nil {
+		app.setMessage("Failed to reorder tasks: %v", err)
+		return
+	}
+
+	err = app.change(fmt.Sprintf("reorder #%d", task.ID), taskIDs(tasks), func() error {
+		return app.reorderCards(tasks)
+	})
+
+	if err != nil {
+		app.setMessage("Failed to reorder tasks: %v", err)
+		return
+	}
+
+	app.loadBoard()
+	app.board.SetCurrentByTaskID(moved)
+}
+
+// columnOrder returns all tasks in state, including those hidden by the task
+// filters, with the shown tasks in the order of tasks. A hidden task stays
+// after the shown task it followed before.
+func (app *mortApp) columnOrder(state string, tasks []store.Task) ([]store.Task, error) {
+	all, err := app.db.GetTasks(store.TaskQuery{States: []string{state}, Archived: true, Sort: "state"})
+
+	if err != nil {
+		return nil, err
+	}
+
+	shown := make(map[int64]bool)
+	for _, task := range tasks {
+		shown[task.ID] = true
+	}
+
+	// hidden maps the ID of a shown task, or 0 for the start of the column,
+	// to the hidden tasks that follow it.
+	hidden := make(map[int64][]store.Task)
+	var anchor int64
+
+	for _, task := range all {
+		if shown[task.ID] {
+			anchor = task.ID
+		} else {
+			hidden[anchor] = append(hidden[anchor], task)
+		}
+	}
+
+	result := append([]store.Task{}, hidden[0]...)
+
+	for _, task := range tasks {
+		result = append(result, task)
+		result = append(result, hidden[task.ID]...)
+	}
+
+	return result, nil
+}
+
+// reorderCards makes tasks in the same state sort in the given order. The
+// tasks keep the state part of their state_idx.
+func (app *mortApp) reorderCards(tasks []store.Task) error {
+	idxs := make([]int, len(tasks))
+
+	for i, task := range tasks {
+		idxs[i] = -1
+		if task.StateIdx != nil {
+			idxs[i] = *task.StateIdx / store.StateStride
+		}
+	}
+
+	return app.db.ReorderTasks(taskIDs(tasks), idxs)
+}
+
+func (app *mortApp) editCurrentBoardTask(g *gocui.Gui) error {
+	task := app.board.CurrentTask()
+
+	if task == nil {
+		app.setMessage("No task.")
+		return nil
+	}
+
+	return app.editTaskBody(g, restart{f: app.editTask, task: task, focus: "board"})
+}
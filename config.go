@@ -0,0 +1,454 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	xdg "github.com/queria/golang-go-xdg"
+
+	"github.com/tomyl/mort/store"
+)
+
+// config holds the user settings read from config.toml. Settings that are
+// left out keep their default values.
+type config struct {
+	// Editor is used when $EDITOR isn't set.
+	Editor string `toml:"editor"`
+
+	// Edit controls how task bodies are edited in the interactive user
+	// interface.
+	Edit editConfig `toml:"edit"`
+
+	// OpenCommand is executed with the task title as argument when opening
+	// a task.
+	OpenCommand string `toml:"open_command"`
+
+	// Workflows are named lists of todo states. Projects that aren't listed
+	// in any workflow use the workflow named default.
+	Workflows map[string]*workflow `toml:"workflows"`
+
+	Formats formatConfig `toml:"formats"`
+
+	Theme themeConfig `toml:"theme"`
+
+	Preview previewConfig `toml:"preview"`
+
+	// Keys maps action names to keys, e.g. "task.clockin" = ["Ctrl-K"]. Actions
+	// that aren't listed keep their default keys.
+	Keys map[string]keyList `toml:"keys"`
+
+	// projects maps project names to workflows.
+	projects map[string]*workflow
+
+	// stateRanks maps todo states to their sort position, see stateRank.
+	stateRanks map[string]int
+
+	// warnings are problems with the config file that aren't errors.
+	warnings []string
+
+	theme *theme
+}
+
+// A workflow is an ordered list of todo states.
+type workflow struct {
+	// States are the todo states in cycling order.
+	States []stateConfig `toml:"states"`
+
+	// Projects use this workflow.
+	Projects []string `toml:"projects"`
+}
+
+type stateConfig struct {
+	Name string `toml:"name"`
+
+	// Color is a color name (black, red, green, yellow, blue, magenta, cyan,
+	// white), a 256-color palette number or empty for no color.
+	Color string `toml:"color"`
+
+	// Done states count as finished, see store.DoneStates.
+	Done bool `toml:"done"`
+}
+
+// editConfig controls the editor of the interactive user interface.
+type editConfig struct {
+	// External edits task bodies in $EDITOR, or Editor if it isn't set,
+	// instead of in the internal editor.
+	External bool `toml:"external"`
+
+	// Vi adds a vi-style normal mode to the internal editor, entered with
+	// Esc. Emacs-style Ctrl keys work in insert mode either way, but no Alt
+	// keys work anywhere since Esc is then passed on without waiting for
+	// the next key.
+	Vi bool `toml:"vi"`
+}
+
+// previewConfig controls the task preview pane of the tasks screen.
+type previewConfig struct {
+	// Show makes the preview pane visible on startup.
+	Show bool `toml:"show"`
+
+	// Width is the share of the screen used by the preview pane in percent.
+	Width int `toml:"width"`
+}
+
+// formatConfig holds time.Format layouts.
+type formatConfig struct {
+	// Time is used for tasks updated today and in the timesheet.
+	Time string `toml:"time"`
+
+	// Weekday is used for tasks updated within a week.
+	Weekday string `toml:"weekday"`
+
+	// Date is used for tasks updated within a year.
+	Date string `toml:"date"`
+
+	// Year is used for older tasks.
+	Year string `toml:"year"`
+
+	// Day is used for the timesheet and the day/week view.
+	Day string `toml:"day"`
+
+	// Timestamp is used by the command-line interface.
+	Timestamp string `toml:"timestamp"`
+}
+
+func defaultConfig() *config {
+	return &config{
+		Editor:      "vim",
+		OpenCommand: "open-mort",
+		Workflows: map[string]*workflow{
+			defaultWorkflow: defaultConfigWorkflow(),
+		},
+		Theme:   themeConfig{Name: "dark"},
+		Preview: previewConfig{Width: 50},
+		Keys:    defaultKeys(),
+		Formats: formatConfig{
+			Time:      "15:04",
+			Weekday:   "Mon",
+			Date:      "Jan 02",
+			Year:      "06 Jan",
+			Day:       "Jan 02 Mon",
+			Timestamp: "2006-01-02 15:04",
+		},
+	}
+}
+
+const defaultWorkflow = "default"
+
+func defaultConfigWorkflow() *workflow {
+	return &workflow{
+		States: []stateConfig{
+			{Name: "TODO", Color: "red"},
+			{Name: "WAIT", Color: "yellow"},
+			{Name: "DONE", Color: "green", Done: true},
+		},
+	}
+}
+
+// conf is the active configuration.
+var conf *config
+
+func init() {
+	defaultConfig().apply()
+}
+
+// configPath returns $MORT_CONFIG or mort/config.toml in the XDG config
+// directory.
+func configPath() string {
+	if path := os.Getenv("MORT_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(xdg.Config.Home(), "mort", "config.toml")
+}
+
+// loadConfig reads the config file at path on top of the defaults. A missing
+// file is not an error.
+func loadConfig(path string) (*config, error) {
+	c := defaultConfig()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return c, nil
+	}
+
+	// Replace rather than merge the default workflows.
+	c.Workflows = nil
+
+	md, err := toml.DecodeFile(path, c)
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		sort.Strings(keys)
+		return nil, fmt.Errorf("%s: unknown setting %s", path, strings.Join(keys, ", "))
+	}
+
+	if c.Workflows == nil {
+		c.Workflows = make(map[string]*workflow)
+	}
+
+	if c.Workflows[defaultWorkflow] == nil {
+		c.Workflows[defaultWorkflow] = defaultConfigWorkflow()
+	}
+
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, warning := range shadowedKeys(c.Keys) {
+		c.warnings = append(c.warnings, fmt.Sprintf("%s: %s", path, warning))
+	}
+
+	return c, nil
+}
+
+func (c *config) validate() error {
+	if strings.TrimSpace(c.Editor) == "" {
+		return fmt.Errorf("editor: must not be empty")
+	}
+
+	if strings.TrimSpace(c.OpenCommand) == "" {
+		return fmt.Errorf("open_command: must not be empty")
+	}
+
+	names := make([]string, 0, len(c.Workflows))
+	for name := range c.Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	projects := make(map[string]string)
+
+	for _, name := range names {
+		w := c.Workflows[name]
+
+		if w == nil || len(w.States) == 0 {
+			return fmt.Errorf("workflows.%s.states: at least one state is required", name)
+		}
+
+		if err := w.validate(); err != nil {
+			return fmt.Errorf("workflows.%s.%v", name, err)
+		}
+
+		for _, project := range w.Projects {
+			if other, ok := projects[project]; ok {
+				return fmt.Errorf("workflows.%s.projects: project %q is already in workflow %s", name, project, other)
+			}
+			projects[project] = name
+		}
+	}
+
+	if _, err := newTheme(c.Theme); err != nil {
+		return fmt.Errorf("theme.%v", err)
+	}
+
+	if c.Preview.Width < 20 || c.Preview.Width > 80 {
+		return fmt.Errorf("preview.width: %d is out of range 20-80", c.Preview.Width)
+	}
+
+	if err := validateKeys(c.Keys); err != nil {
+		return err
+	}
+
+	formats := []struct {
+		name   string
+		layout string
+	}{
+		{"time", c.Formats.Time},
+		{"weekday", c.Formats.Weekday},
+		{"date", c.Formats.Date},
+		{"year", c.Formats.Year},
+		{"day", c.Formats.Day},
+		{"timestamp", c.Formats.Timestamp},
+	}
+
+	for _, format := range formats {
+		if strings.TrimSpace(format.layout) == "" {
+			return fmt.Errorf("formats.%s: must not be empty", format.name)
+		}
+	}
+
+	return nil
+}
+
+func (w *workflow) validate() error {
+	seen := make(map[string]bool)
+
+	for i, state := range w.States {
+		switch {
+		case state.Name == "":
+			return fmt.Errorf("states[%d].name: must not be empty", i)
+		case strings.ContainsAny(state.Name, " \t\n,:\""):
+			return fmt.Errorf("states[%d].name: %q must not contain spaces, commas, colons or quotes", i, state.Name)
+		case state.Name != strings.ToUpper(state.Name):
+			return fmt.Errorf("states[%d].name: %q must be upper case", i, state.Name)
+		case state.Name == "NONE":
+			return fmt.Errorf("states[%d].name: NONE is reserved", i)
+		case seen[state.Name]:
+			return fmt.Errorf("states[%d].name: duplicate state %q", i, state.Name)
+		}
+
+		seen[state.Name] = true
+
+		if state.Color != "" {
+			if _, err := parseColor(state.Color); err != nil {
+				return fmt.Errorf("states[%d].color: %v", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply makes c the active configuration. c must be valid.
+func (c *config) apply() {
+	conf = c
+	c.theme, _ = newTheme(c.Theme)
+	store.FallbackEditor = c.Editor
+	store.DateFormat = c.Formats.Day
+
+	c.projects = make(map[string]*workflow)
+	store.DoneStates = nil
+	done := make(map[string]bool)
+
+	for _, w := range c.Workflows {
+		for _, project := range w.Projects {
+			c.projects[project] = w
+		}
+		for _, state := range w.States {
+			if state.Done && !done[state.Name] {
+				store.DoneStates = append(store.DoneStates, state.Name)
+				done[state.Name] = true
+			}
+		}
+	}
+
+	sort.Strings(store.DoneStates)
+
+	c.stateRanks = make(map[string]int)
+	for i, name := range c.stateOrder() {
+		c.stateRanks[name] = i
+	}
+}
+
+// stateOrder merges the states of all workflows into one order, starting with
+// the default workflow. A state that is only in some workflows is put after
+// the state before it in its workflow, so that tasks of projects with
+// different workflows sort sensibly together.
+func (c *config) stateOrder() []string {
+	names := make([]string, 0, len(c.Workflows))
+	for name := range c.Workflows {
+		if name != defaultWorkflow {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	names = append([]string{defaultWorkflow}, names...)
+
+	var order []string
+
+	for _, name := range names {
+		w := c.Workflows[name]
+		if w == nil {
+			continue
+		}
+
+		pos := 0
+
+		for _, state := range w.States {
+			found := false
+
+			for i := range order {
+				if order[i] == state.Name {
+					if i >= pos {
+						pos = i + 1
+					}
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				order = append(order[:pos], append([]string{state.Name}, order[pos:]...)...)
+				pos++
+			}
+		}
+	}
+
+	return order
+}
+
+// stateRank returns the sort position of state across all workflows, or -1
+// for no state. Stored positions are updated with store.RenumberStates when
+// the workflows change.
+func stateRank(state string) int {
+	if rank, ok := conf.stateRanks[state]; ok {
+		return rank
+	}
+	return -1
+}
+
+// getWorkflow returns the workflow used by project.
+func getWorkflow(project string) *workflow {
+	if w, ok := conf.projects[project]; ok {
+		return w
+	}
+	return conf.Workflows[defaultWorkflow]
+}
+
+// stateIndex returns the position of state in the workflow or -1.
+func (w *workflow) stateIndex(state string) int {
+	for i := range w.States {
+		if w.States[i].Name == state {
+			return i
+		}
+	}
+	return -1
+}
+
+// stateNames returns the names of the workflow states.
+func (w *workflow) stateNames() []string {
+	names := make([]string, len(w.States))
+	for i := range w.States {
+		names[i] = w.States[i].Name
+	}
+	return names
+}
+
+// next returns the index of the state after idx, wrapping around to -1 (no
+// state). A negative step cycles backwards.
+func (w *workflow) next(idx, step int) int {
+	n := len(w.States) + 1
+	// Shift so that "no state" is position 0.
+	pos := (idx + 1 + step%n + n) % n
+	return pos - 1
+}
+
+func cmdConfig(c *command, fs *flag.FlagSet) commandFunc {
+	path := fs.Bool("path", false, "Print the path of the config file")
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		if *path {
+			fmt.Println(configPath())
+			return nil
+		}
+
+		return toml.NewEncoder(os.Stdout).Encode(conf)
+	}
+}
@@ -0,0 +1,1202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xui"
+)
+
+// editorTabWidth is the tab stop used when Tab inserts spaces.
+const editorTabWidth = 4
+
+// An editorKey is a key as passed to a gocui.Editor.
+type editorKey struct {
+	key gocui.Key
+	ch  rune
+	mod gocui.Modifier
+}
+
+// An editorState is the text and cursor before an undoable change.
+type editorState struct {
+	text string
+	row  int
+	col  int
+}
+
+// A screenRow is the part of a line shown on one row of the editor.
+type screenRow struct {
+	line  int
+	start int
+	end   int
+}
+
+// editorWidget is a multi-line text editor with Emacs-style keys and an
+// optional vi-style normal mode. Long lines are wrapped at spaces.
+type editorWidget struct {
+	view  *gocui.View
+	lines [][]rune
+
+	// row and col are the cursor position in lines. col is at most the
+	// length of the line.
+	row int
+	col int
+
+	// goal is the screen column kept by vertical movement, or -1.
+	goal     int
+	keepGoal bool
+
+	// offset is the first visible screen row.
+	offset int
+
+	// vi enables the normal mode and normal is set while in it.
+	vi     bool
+	normal bool
+
+	// pending is the first key of a two-key normal mode command, e.g. d of
+	// dd.
+	pending rune
+
+	// count is the repeat count typed before a normal mode command, or 0.
+	count int
+
+	// killed is the text removed by the last kill or delete line command.
+	killed string
+
+	// undo holds the states before each change, the latest last. merge is
+	// set while changes are added to the latest state, i.e. during a vi
+	// insert or a run of typed characters.
+	undo  []editorState
+	merge bool
+
+	// bound keys are left to the keybindings of the editor view.
+	bound map[editorKey]bool
+
+	// done is called by the normal mode commands ZZ and ZQ.
+	done func(save bool)
+
+	// changed is called after every key handled by the editor.
+	changed func()
+}
+
+func (w *editorWidget) View() *gocui.View {
+	return w.view
+}
+
+func (w *editorWidget) SetView(view *gocui.View) {
+	if view != nil {
+		view.Wrap = false
+		view.Editable = true
+		view.Editor = gocui.EditorFunc(w.edit)
+	}
+	w.view = view
+	w.render()
+}
+
+// SetText replaces the text and puts the cursor at its end. With vi set, the
+// editor starts in normal mode unless insert is set.
+func (w *editorWidget) SetText(text string, vi, insert bool) {
+	w.setLines(text)
+	w.row = len(w.lines) - 1
+	w.col = len(w.lines[w.row])
+	w.goal = -1
+	w.offset = 0
+	w.vi = vi
+	w.normal = vi && !insert
+	w.pending = 0
+	w.count = 0
+	w.undo = nil
+	w.merge = false
+	w.clamp()
+	w.render()
+}
+
+func (w *editorWidget) setLines(text string) {
+	w.lines = nil
+
+	for _, line := range strings.Split(text, "\n") {
+		w.lines = append(w.lines, []rune(line))
+	}
+}
+
+// Text returns the edited text.
+func (w *editorWidget) Text() string {
+	lines := make([]string, len(w.lines))
+	for i, line := range w.lines {
+		lines[i] = string(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Mode returns INSERT or NORMAL if the vi mode is enabled.
+func (w *editorWidget) Mode() string {
+	switch {
+	case !w.vi:
+		return ""
+	case w.normal:
+		return "NORMAL"
+	}
+	return "INSERT"
+}
+
+// Position returns the line and column of the cursor, counting from 1.
+func (w *editorWidget) Position() (int, int) {
+	return w.row + 1, w.col + 1
+}
+
+// SetBoundKeys makes the editor leave keys to keybindings, see parseKey.
+func (w *editorWidget) SetBoundKeys(keys []string) error {
+	w.bound = make(map[editorKey]bool)
+
+	for _, s := range keys {
+		key, mod, err := parseKey(s)
+		if err != nil {
+			return err
+		}
+		switch key := key.(type) {
+		case gocui.Key:
+			w.bound[editorKey{key: key, mod: mod}] = true
+		case rune:
+			w.bound[editorKey{ch: key, mod: mod}] = true
+		}
+	}
+
+	return nil
+}
+
+func (w *editorWidget) edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) bool {
+	if key == gocui.KeyCtrlC || w.bound[editorKey{key, ch, mod}] {
+		return false
+	}
+
+	quit, save := false, false
+	w.keepGoal = false
+	before := editorState{w.Text(), w.row, w.col}
+	undo := w.normal && ch == 'u' && mod == gocui.ModNone && w.pending == 0 && w.count == 0 ||
+		!w.normal && ch == 0 && key == gocui.KeyCtrlUnderscore
+
+	switch {
+	case undo:
+		w.undoChange()
+	case w.normal:
+		quit, save = w.normalKey(key, ch, mod)
+	default:
+		w.insertKey(key, ch, mod)
+	}
+
+	changed := !undo && w.Text() != before.text
+
+	if changed && !w.merge {
+		w.undo = append(w.undo, before)
+	}
+
+	switch {
+	case undo:
+		w.merge = false
+	case w.vi:
+		w.merge = !w.normal && (w.merge || changed)
+	default:
+		w.merge = changed && ch != 0 && mod == gocui.ModNone
+	}
+
+	if !w.keepGoal {
+		w.goal = -1
+	}
+
+	w.clamp()
+	w.render()
+
+	if quit {
+		if w.done != nil {
+			w.done(save)
+		}
+	} else if w.changed != nil {
+		w.changed()
+	}
+
+	return true
+}
+
+// insertKey handles a key in insert mode, or in any mode if vi isn't
+// enabled.
+func (w *editorWidget) insertKey(key gocui.Key, ch rune, mod gocui.Modifier) {
+	if mod == gocui.ModAlt {
+		switch ch {
+		case 'f':
+			w.wordEnd()
+		case 'b':
+			w.wordBackward()
+		case 'd':
+			w.killWordForward()
+		case 'v':
+			w.movePage(-1)
+		case '<':
+			w.row, w.col = 0, 0
+		case '>':
+			w.row = len(w.lines) - 1
+			w.col = len(w.lines[w.row])
+		}
+		return
+	}
+
+	if ch != 0 {
+		w.insert(string(ch))
+		return
+	}
+
+	switch key {
+	case gocui.KeySpace:
+		w.insert(" ")
+	case gocui.KeyTab:
+		w.insert(strings.Repeat(" ", editorTabWidth-w.col%editorTabWidth))
+	case gocui.KeyEnter, gocui.KeyCtrlJ:
+		w.insert("\n")
+	case gocui.KeyBackspace, gocui.KeyBackspace2:
+		w.deleteBackward()
+	case gocui.KeyDelete, gocui.KeyCtrlD:
+		w.deleteForward()
+	case gocui.KeyArrowLeft, gocui.KeyCtrlB:
+		w.backward()
+	case gocui.KeyArrowRight, gocui.KeyCtrlF:
+		w.forward()
+	case gocui.KeyArrowUp, gocui.KeyCtrlP:
+		w.moveRow(-1)
+	case gocui.KeyArrowDown, gocui.KeyCtrlN:
+		w.moveRow(1)
+	case gocui.KeyHome, gocui.KeyCtrlA:
+		w.col = 0
+	case gocui.KeyEnd, gocui.KeyCtrlE:
+		w.col = len(w.lines[w.row])
+	case gocui.KeyPgup:
+		w.movePage(-1)
+	case gocui.KeyPgdn, gocui.KeyCtrlV:
+		w.movePage(1)
+	case gocui.KeyCtrlK:
+		w.killLine()
+	case gocui.KeyCtrlU:
+		w.killed = string(w.lines[w.row][:w.col])
+		w.remove(0, w.col)
+		w.col = 0
+	case gocui.KeyCtrlW:
+		w.killWordBackward()
+	case gocui.KeyCtrlY:
+		w.insert(w.killed)
+	case gocui.KeyEsc:
+		if w.vi {
+			w.normal = true
+			if w.col > 0 {
+				w.col--
+			}
+		}
+	}
+}
+
+// normalKey handles a key in vi normal mode. quit is set by ZZ and ZQ.
+func (w *editorWidget) normalKey(key gocui.Key, ch rune, mod gocui.Modifier) (quit, save bool) {
+	pending := w.pending
+	w.pending = 0
+	count := w.count
+	w.count = 0
+	line := w.lines[w.row]
+
+	if ch == 0 {
+		switch key {
+		case gocui.KeyArrowLeft, gocui.KeyBackspace, gocui.KeyBackspace2:
+			w.backward()
+		case gocui.KeyArrowRight, gocui.KeySpace:
+			w.forward()
+		case gocui.KeyArrowUp:
+			w.moveRow(-1)
+		case gocui.KeyArrowDown:
+			w.moveRow(1)
+		case gocui.KeyEnter:
+			if w.row < len(w.lines)-1 {
+				w.row++
+				w.firstNonBlank()
+			}
+		case gocui.KeyHome:
+			w.col = 0
+		case gocui.KeyEnd:
+			w.col = len(line)
+		case gocui.KeyPgup, gocui.KeyCtrlB:
+			w.movePage(-1)
+		case gocui.KeyPgdn, gocui.KeyCtrlF:
+			w.movePage(1)
+		case gocui.KeyDelete:
+			if w.col < len(line) {
+				w.remove(w.col, w.col+1)
+			}
+		}
+		return false, false
+	}
+
+	if mod != gocui.ModNone {
+		return false, false
+	}
+
+	if pending == 0 && (ch >= '1' && ch <= '9' || ch == '0' && count > 0) {
+		w.count = count*10 + int(ch-'0')
+		return false, false
+	}
+
+	n := count
+	if n < 1 {
+		n = 1
+	}
+
+	switch pending {
+	case 'd':
+		if ch == 'd' {
+			w.deleteLines(n)
+		}
+		return false, false
+	case 'g':
+		if ch == 'g' {
+			w.row = n - 1
+			w.clamp()
+			w.firstNonBlank()
+		}
+		return false, false
+	case 'Z':
+		return ch == 'Z' || ch == 'Q', ch == 'Z'
+	}
+
+	switch ch {
+	case 'd', 'g', 'Z':
+		w.pending = ch
+		w.count = count
+	case 'G':
+		w.row = len(w.lines) - 1
+		if count > 0 && count < len(w.lines) {
+			w.row = count - 1
+		}
+		w.firstNonBlank()
+	case 'i', 'a', 'I', 'A', 'o', 'O':
+		w.normalCommand(ch)
+	case 'J':
+		// Like in vi, J and 2J both join two lines.
+		if n > 1 {
+			n--
+		}
+		for i := 0; i < n; i++ {
+			w.joinLine()
+		}
+	default:
+		for i := 0; i < n; i++ {
+			w.normalCommand(ch)
+		}
+	}
+
+	return false, false
+}
+
+// normalCommand runs a single-key normal mode command once.
+func (w *editorWidget) normalCommand(ch rune) {
+	line := w.lines[w.row]
+
+	switch ch {
+	case 'h':
+		if w.col > 0 {
+			w.col--
+		}
+	case 'l':
+		if w.col+1 < len(line) {
+			w.col++
+		}
+	case 'j':
+		w.moveRow(1)
+	case 'k':
+		w.moveRow(-1)
+	case '0':
+		w.col = 0
+	case '^':
+		w.firstNonBlank()
+	case '$':
+		w.col = len(line)
+	case 'w':
+		w.wordStart()
+	case 'b':
+		w.wordBackward()
+	case 'e':
+		w.forward()
+		w.wordEnd()
+		w.backward()
+	case 'x':
+		if w.col < len(line) {
+			w.remove(w.col, w.col+1)
+		}
+	case 'X':
+		if w.col > 0 {
+			w.col--
+			w.remove(w.col, w.col+1)
+		}
+	case 'D':
+		if w.col < len(line) {
+			w.killLine()
+		}
+	case 'i':
+		w.normal = false
+	case 'a':
+		w.normal = false
+		if w.col < len(line) {
+			w.col++
+		}
+	case 'I':
+		w.normal = false
+		w.firstNonBlank()
+	case 'A':
+		w.normal = false
+		w.col = len(line)
+	case 'o':
+		w.normal = false
+		w.col = len(line)
+		w.insert("\n")
+	case 'O':
+		w.normal = false
+		w.col = 0
+		w.insert("\n")
+		w.row--
+	case 'p':
+		w.put()
+	}
+}
+
+// insert inserts s at the cursor and moves the cursor after it.
+func (w *editorWidget) insert(s string) {
+	line := w.lines[w.row]
+	tail := append([]rune{}, line[w.col:]...)
+	parts := strings.Split(s, "\n")
+	head := append(line[:w.col:w.col], []rune(parts[0])...)
+
+	if len(parts) == 1 {
+		w.col = len(head)
+		w.lines[w.row] = append(head, tail...)
+		return
+	}
+
+	inserted := [][]rune{head}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		inserted = append(inserted, []rune(part))
+	}
+
+	last := []rune(parts[len(parts)-1])
+	w.col = len(last)
+	inserted = append(inserted, append(last, tail...))
+
+	w.lines = append(w.lines[:w.row], append(inserted, w.lines[w.row+1:]...)...)
+	w.row += len(parts) - 1
+}
+
+// remove removes the runes from start to end of the cursor line.
+func (w *editorWidget) remove(start, end int) {
+	line := w.lines[w.row]
+	w.lines[w.row] = append(line[:start:start], line[end:]...)
+}
+
+// join appends the next line to the cursor line.
+func (w *editorWidget) join() {
+	if w.row+1 < len(w.lines) {
+		w.lines[w.row] = append(w.lines[w.row], w.lines[w.row+1]...)
+		w.lines = append(w.lines[:w.row+1], w.lines[w.row+2:]...)
+	}
+}
+
+func (w *editorWidget) deleteBackward() {
+	if w.col > 0 {
+		w.col--
+		w.remove(w.col, w.col+1)
+	} else if w.row > 0 {
+		w.row--
+		w.col = len(w.lines[w.row])
+		w.join()
+	}
+}
+
+func (w *editorWidget) deleteForward() {
+	if w.col < len(w.lines[w.row]) {
+		w.remove(w.col, w.col+1)
+	} else {
+		w.join()
+	}
+}
+
+// killLine kills the rest of the line, or the line break at the end of the
+// line.
+func (w *editorWidget) killLine() {
+	if line := w.lines[w.row]; w.col < len(line) {
+		w.killed = string(line[w.col:])
+		w.remove(w.col, len(line))
+	} else if w.row+1 < len(w.lines) {
+		w.killed = "\n"
+		w.join()
+	}
+}
+
+func (w *editorWidget) killWordBackward() {
+	if w.col == 0 {
+		w.deleteBackward()
+		return
+	}
+
+	line := w.lines[w.row]
+	start := w.col
+
+	for start > 0 && !isWordRune(line[start-1]) {
+		start--
+	}
+
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+
+	w.killed = string(line[start:w.col])
+	w.remove(start, w.col)
+	w.col = start
+}
+
+func (w *editorWidget) killWordForward() {
+	line := w.lines[w.row]
+
+	if w.col == len(line) {
+		w.join()
+		return
+	}
+
+	end := w.col
+
+	for end < len(line) && !isWordRune(line[end]) {
+		end++
+	}
+
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+
+	w.killed = string(line[w.col:end])
+	w.remove(w.col, end)
+}
+
+// deleteLines kills n lines from the cursor line including their line
+// breaks.
+func (w *editorWidget) deleteLines(n int) {
+	end := w.row + n
+
+	if end > len(w.lines) {
+		end = len(w.lines)
+	}
+
+	killed := make([]string, 0, end-w.row)
+
+	for _, line := range w.lines[w.row:end] {
+		killed = append(killed, string(line))
+	}
+
+	w.killed = strings.Join(killed, "\n") + "\n"
+
+	if w.row == 0 && end == len(w.lines) {
+		w.lines = [][]rune{nil}
+	} else {
+		w.lines = append(w.lines[:w.row], w.lines[end:]...)
+	}
+
+	if w.row >= len(w.lines) {
+		w.row = len(w.lines) - 1
+	}
+
+	w.firstNonBlank()
+}
+
+// put inserts the killed text after the cursor. Killed lines are put below
+// the cursor line.
+func (w *editorWidget) put() {
+	if w.killed == "" {
+		return
+	}
+
+	if strings.HasSuffix(w.killed, "\n") {
+		row := w.row
+		w.col = len(w.lines[w.row])
+		w.insert("\n" + strings.TrimSuffix(w.killed, "\n"))
+		w.row = row + 1
+		w.firstNonBlank()
+		return
+	}
+
+	if w.col < len(w.lines[w.row]) {
+		w.col++
+	}
+
+	w.insert(w.killed)
+	w.col--
+}
+
+// joinLine joins the next line to the cursor line with a space.
+func (w *editorWidget) joinLine() {
+	if w.row+1 >= len(w.lines) {
+		return
+	}
+
+	next := w.lines[w.row+1]
+
+	for len(next) > 0 && unicode.IsSpace(next[0]) {
+		next = next[1:]
+	}
+
+	w.lines[w.row+1] = next
+	w.col = len(w.lines[w.row])
+
+	if w.col > 0 && len(next) > 0 {
+		w.insert(" ")
+		w.col--
+	}
+
+	w.join()
+}
+
+// undoChange restores the text and cursor from before the last change.
+func (w *editorWidget) undoChange() {
+	if len(w.undo) == 0 {
+		return
+	}
+
+	state := w.undo[len(w.undo)-1]
+	w.undo = w.undo[:len(w.undo)-1]
+	w.setLines(state.text)
+	w.row, w.col = state.row, state.col
+}
+
+// at returns the rune under the cursor, or a newline at the end of a line.
+func (w *editorWidget) at() rune {
+	if line := w.lines[w.row]; w.col < len(line) {
+		return line[w.col]
+	}
+	return '\n'
+}
+
+// forward moves the cursor one rune forward, crossing lines, and reports
+// whether it moved.
+func (w *editorWidget) forward() bool {
+	if w.col < len(w.lines[w.row]) {
+		w.col++
+		return true
+	}
+
+	if w.row+1 < len(w.lines) {
+		w.row++
+		w.col = 0
+		return true
+	}
+
+	return false
+}
+
+// backward moves the cursor one rune backward, crossing lines, and reports
+// whether it moved.
+func (w *editorWidget) backward() bool {
+	if w.col > 0 {
+		w.col--
+		return true
+	}
+
+	if w.row > 0 {
+		w.row--
+		w.col = len(w.lines[w.row])
+		return true
+	}
+
+	return false
+}
+
+// wordStart moves the cursor to the start of the next word.
+func (w *editorWidget) wordStart() {
+	for isWordRune(w.at()) && w.forward() {
+	}
+	for !isWordRune(w.at()) && w.forward() {
+	}
+}
+
+// wordEnd moves the cursor past the end of the current or next word.
+func (w *editorWidget) wordEnd() {
+	for !isWordRune(w.at()) && w.forward() {
+	}
+	for isWordRune(w.at()) && w.forward() {
+	}
+}
+
+// wordBackward moves the cursor to the start of the current or previous
+// word.
+func (w *editorWidget) wordBackward() {
+	w.backward()
+
+	for !isWordRune(w.at()) && w.backward() {
+	}
+
+	for w.col > 0 && isWordRune(w.lines[w.row][w.col-1]) {
+		w.col--
+	}
+}
+
+func (w *editorWidget) firstNonBlank() {
+	line := w.lines[w.row]
+	w.col = 0
+
+	for w.col < len(line) && unicode.IsSpace(line[w.col]) {
+		w.col++
+	}
+}
+
+// moveRow moves the cursor step screen rows down, or up if negative, keeping
+// the screen column.
+func (w *editorWidget) moveRow(step int) {
+	width, _ := w.size()
+	rows := w.screenRows(width)
+	cur := w.cursorRow(rows)
+
+	if w.goal < 0 {
+		w.goal = runesWidth(w.lines[w.row][rows[cur].start:w.col])
+	}
+
+	target := cur + step
+
+	if target < 0 {
+		target = 0
+	}
+
+	if target >= len(rows) {
+		target = len(rows) - 1
+	}
+
+	r := rows[target]
+	line := w.lines[r.line]
+	col, cells := r.start, 0
+
+	for col < r.end && cells+runeWidth(line[col]) <= w.goal {
+		cells += runeWidth(line[col])
+		col++
+	}
+
+	// The end of a wrapped row is the start of the next one.
+	if col == r.end && col > r.start && target+1 < len(rows) && rows[target+1].line == r.line {
+		col--
+	}
+
+	w.row, w.col = r.line, col
+	w.keepGoal = true
+}
+
+// movePage moves the cursor step pages down, or up if negative.
+func (w *editorWidget) movePage(step int) {
+	_, height := w.size()
+
+	if height > 2 {
+		height--
+	}
+
+	w.moveRow(step * height)
+}
+
+// clamp keeps the cursor within the text. In normal mode the cursor stays on
+// a rune.
+func (w *editorWidget) clamp() {
+	if len(w.lines) == 0 {
+		w.lines = [][]rune{nil}
+	}
+
+	if w.row >= len(w.lines) {
+		w.row = len(w.lines) - 1
+	}
+
+	if w.row < 0 {
+		w.row = 0
+	}
+
+	line := w.lines[w.row]
+
+	if w.col > len(line) {
+		w.col = len(line)
+	}
+
+	if w.col < 0 {
+		w.col = 0
+	}
+
+	if w.normal && w.col > 0 && w.col >= len(line) {
+		w.col = len(line) - 1
+	}
+}
+
+// size returns the width available for text and the height of the view. One
+// column is left for the cursor at the end of a line.
+func (w *editorWidget) size() (int, int) {
+	if w.view == nil {
+		return 80, 24
+	}
+
+	sx, sy := w.view.Size()
+
+	if sx < 2 {
+		sx = 2
+	}
+
+	return sx - 1, sy
+}
+
+// screenRows wraps the lines at width.
+func (w *editorWidget) screenRows(width int) []screenRow {
+	rows := make([]screenRow, 0, len(w.lines))
+
+	for i, line := range w.lines {
+		starts := wrapLine(line, width)
+		for j, start := range starts {
+			end := len(line)
+			if j+1 < len(starts) {
+				end = starts[j+1]
+			}
+			rows = append(rows, screenRow{i, start, end})
+		}
+	}
+
+	return rows
+}
+
+// cursorRow returns the index of the screen row with the cursor.
+func (w *editorWidget) cursorRow(rows []screenRow) int {
+	for i, r := range rows {
+		last := i+1 == len(rows) || rows[i+1].line != r.line
+		if r.line == w.row && w.col >= r.start && (w.col < r.end || last) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (w *editorWidget) render() {
+	view := w.view
+
+	if view == nil {
+		return
+	}
+
+	view.Clear()
+
+	if len(w.lines) == 0 {
+		return
+	}
+
+	width, height := w.size()
+	rows := w.screenRows(width)
+	cur := w.cursorRow(rows)
+
+	if cur < w.offset {
+		w.offset = cur
+	}
+
+	if height > 0 && cur >= w.offset+height {
+		w.offset = cur - height + 1
+	}
+
+	cursor := conf.theme.ansi(style{Reverse: true})
+	var b strings.Builder
+
+	for i := w.offset; i < len(rows) && i < w.offset+height; i++ {
+		r := rows[i]
+		line := w.lines[r.line]
+
+		if i != cur {
+			text := editorText(line[r.start:r.end])
+			if text == "" && b.Len() == 0 {
+				// gocui drops a leading line break.
+				text = " "
+			}
+			b.WriteString(text + "\n")
+			continue
+		}
+
+		under := " "
+
+		if w.col < r.end {
+			under = editorText(line[w.col : w.col+1])
+		}
+
+		b.WriteString(editorText(line[r.start:w.col]))
+		b.WriteString(cursor + under + ansiReset)
+
+		if w.col < r.end {
+			b.WriteString(editorText(line[w.col+1 : r.end]))
+		}
+
+		b.WriteString("\n")
+	}
+
+	fmt.Fprint(view, b.String())
+}
+
+// wrapLine returns the start of each screen row of line when wrapped at
+// width columns. Rows are broken after the last space that fits, or within
+// words that don't fit on a row.
+func wrapLine(line []rune, width int) []int {
+	starts := []int{0}
+	start, cells, space := 0, 0, -1
+
+	for i := 0; i < len(line); i++ {
+		w := runeWidth(line[i])
+
+		if cells+w > width && i > start {
+			next := i
+			if space >= start {
+				next = space + 1
+			}
+
+			starts = append(starts, next)
+			start, cells, space = next, 0, -1
+
+			for j := start; j < i; j++ {
+				cells += runeWidth(line[j])
+			}
+		}
+
+		if line[i] == ' ' {
+			space = i
+		}
+
+		cells += w
+	}
+
+	return starts
+}
+
+// editorText replaces control characters, e.g. tabs, with spaces.
+func editorText(runes []rune) string {
+	var b strings.Builder
+	for _, r := range runes {
+		if unicode.IsControl(r) {
+			r = ' '
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func runeWidth(r rune) int {
+	return xui.StringWidth(string(r))
+}
+
+func runesWidth(runes []rune) int {
+	return xui.StringWidth(string(runes))
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// An editSession is a task body being edited in the internal editor.
+type editSession struct {
+	title string
+
+	// focus is the view to return to.
+	focus *gocui.View
+
+	// save stores the edited body and cancel is called with the body when
+	// editing is cancelled.
+	save   func(body string)
+	cancel func(body string)
+
+	// external continues editing body in the external editor.
+	external func(body string) error
+}
+
+// openEditor edits body in the internal editor. insert starts the editor in
+// insert mode if the vi mode is enabled.
+func (app *mortApp) openEditor(g *gocui.Gui, body string, insert bool, e *editSession) {
+	e.focus = g.CurrentView()
+	app.edit = e
+
+	app.editor.done = func(save bool) {
+		app.closeEditor(g, save)
+	}
+
+	app.editor.changed = app.showEditorStatus
+	app.editor.SetText(body, conf.Edit.Vi, insert)
+	app.gx.Focus(app.editor.View())
+	app.showEditorStatus()
+	app.setMessage("%s to save, %s to cancel.", keyHint("editor.save"), keyHint("editor.cancel"))
+}
+
+func (app *mortApp) showEditorStatus() {
+	if app.edit == nil {
+		return
+	}
+
+	line, col := app.editor.Position()
+	msg := fmt.Sprintf("%s | line %d, column %d", app.edit.title, line, col)
+
+	if mode := app.editor.Mode(); mode != "" {
+		msg += " | " + mode
+	}
+
+	app.setStatus(msg)
+}
+
+// closeEditor returns to the previous screen, saving the edited body if save
+// is set.
+func (app *mortApp) closeEditor(g *gocui.Gui, save bool) {
+	e, body := app.leaveEditor()
+
+	if e == nil {
+		return
+	}
+
+	if save {
+		e.save(body)
+	} else {
+		if e.cancel != nil {
+			e.cancel(body)
+		}
+		app.setMessage("Cancelled.")
+	}
+
+	app.reloadView(g)
+}
+
+// quitEditor leaves the editor when mort exits. The text is handled as if
+// editing was cancelled, so the draft of a new task is kept.
+func (app *mortApp) quitEditor() {
+	e, body := app.leaveEditor()
+
+	if e != nil && e.cancel != nil {
+		e.cancel(body)
+	}
+}
+
+// externalEditor continues editing in the external editor.
+func (app *mortApp) externalEditor() error {
+	e, body := app.leaveEditor()
+
+	if e == nil {
+		return nil
+	}
+
+	return e.external(body)
+}
+
+// leaveEditor focuses the screen the editor was opened from and returns the
+// session and the edited body.
+func (app *mortApp) leaveEditor() (*editSession, string) {
+	e := app.edit
+
+	if e == nil {
+		return nil, ""
+	}
+
+	app.edit = nil
+
+	if e.focus == app.tasks.View() {
+		app.focusTasks()
+	} else {
+		app.gx.Focus(e.focus)
+	}
+
+	return e, app.editor.Text()
+}
+
+// captureTask writes a new task, or a subtask of parentID if positive, in the
+// editor. The draft of a cancelled task is kept for the next new task.
+func (app *mortApp) captureTask(g *gocui.Gui, parentID int64) error {
+	if conf.Edit.External {
+		return restart{f: app.createTask, parentID: parentID}
+	}
+
+	body, err := app.db.ReadDraft(0)
+
+	if err != nil {
+		app.setMessage("Failed to get draft: %v", err)
+		return nil
+	}
+
+	title := "New task"
+
+	if parentID > 0 {
+		title = fmt.Sprintf("New subtask of #%d", parentID)
+	}
+
+	app.openEditor(g, body, true, &editSession{
+		title: title,
+		save: func(body string) {
+			app.saveNewTask(parentID, body)
+		},
+		cancel: func(body string) {
+			if err := app.db.SetDraft(0, body); err != nil {
+				log.Println(err)
+			}
+		},
+		external: func(body string) error {
+			if err := app.db.SetDraft(0, body); err != nil {
+				return err
+			}
+			return restart{f: app.createTask, parentID: parentID}
+		},
+	})
+
+	return nil
+}
+
+// editTaskBody edits the body of r.task in the editor. r restarts mort with
+// the external editor if configured.
+func (app *mortApp) editTaskBody(g *gocui.Gui, r restart) error {
+	if conf.Edit.External {
+		return r
+	}
+
+	task := r.task
+
+	app.openEditor(g, task.Body, false, &editSession{
+		title: fmt.Sprintf("Editing #%d", task.ID),
+		save: func(body string) {
+			app.saveTaskBody(task, body)
+		},
+		external: func(body string) error {
+			if err := app.db.SetDraft(task.ID, body); err != nil {
+				return err
+			}
+			r.draft = true
+			return r
+		},
+	})
+
+	return nil
+}
+
+// saveTaskBody updates the body of task, and its title and project.
+func (app *mortApp) saveTaskBody(task *store.Task, body string) {
+	if body == "" {
+		app.setMessage("Empty body.")
+		return
+	}
+
+	if body == task.Body {
+		app.setMessage("No change.")
+		return
+	}
+
+	var payload store.Task
+	payload.Title = store.GetTitleFromBody(body)
+	payload.Project = store.GetProjectFromTitle(payload.Title)
+	payload.Body = body
+
+	err := app.change(fmt.Sprintf("edit #%d", task.ID), []int64{task.ID}, func() error {
+		return app.db.UpdateTaskByID(task.ID, payload)
+	})
+
+	if err != nil {
+		app.setMessage("Failed to update task: %v", err)
+		return
+	}
+
+	app.resetFilters()
+	app.setMessage("Updated task.")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/gocui"
+)
+
+// keys turns strings into typed runes and gocui.Keys into key presses.
+// editorKeys are passed as is.
+func keys(items ...interface{}) []editorKey {
+	var pressed []editorKey
+	for _, item := range items {
+		switch item := item.(type) {
+		case string:
+			for _, ch := range item {
+				pressed = append(pressed, editorKey{ch: ch})
+			}
+		case gocui.Key:
+			pressed = append(pressed, editorKey{key: item})
+		case editorKey:
+			pressed = append(pressed, item)
+		}
+	}
+	return pressed
+}
+
+func TestWrapLine(t *testing.T) {
+	tests := []struct {
+		line  string
+		width int
+		want  []int
+	}{
+		{"", 10, []int{0}},
+		{"hello world", 20, []int{0}},
+		{"hello world", 11, []int{0}},
+		{"hello world", 8, []int{0, 6}},
+		{"abcdefghij", 4, []int{0, 4, 8}},
+		{"ab cdefghij", 4, []int{0, 3, 7}},
+		{"a b c d", 3, []int{0, 2, 4}},
+		{"日本語", 4, []int{0, 2}},
+	}
+
+	for _, tc := range tests {
+		require.Equal(t, tc.want, wrapLine([]rune(tc.line), tc.width), "%q at %d", tc.line, tc.width)
+	}
+}
+
+func TestEditorBuffer(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		row, col int
+		edit     func(w *editorWidget)
+		want     string
+		wantRow  int
+		wantCol  int
+	}{
+		{"insert rune", "abc", 0, 1, func(w *editorWidget) { w.insert("X") }, "aXbc", 0, 2},
+		{"insert line break", "abc", 0, 3, func(w *editorWidget) { w.insert("\n") }, "abc\n", 1, 0},
+		{"insert lines", "abc", 0, 1, func(w *editorWidget) { w.insert("X\nY") }, "aX\nYbc", 1, 1},
+		{"insert between lines", "a\nb", 0, 1, func(w *editorWidget) { w.insert("1\n2\n3") }, "a1\n2\n3\nb", 2, 1},
+		{"remove", "abcdef", 0, 0, func(w *editorWidget) { w.remove(1, 3) }, "adef", 0, 0},
+		{"remove all", "abc\nd", 0, 0, func(w *editorWidget) { w.remove(0, 3) }, "\nd", 0, 0},
+		{"kill line", "abc def", 0, 3, func(w *editorWidget) { w.killLine() }, "abc", 0, 3},
+		{"kill line at end", "ab\ncd", 0, 2, func(w *editorWidget) { w.killLine() }, "abcd", 0, 2},
+		{"kill line at end of text", "ab", 0, 2, func(w *editorWidget) { w.killLine() }, "ab", 0, 2},
+		{"delete line", "a\nb\nc", 1, 0, func(w *editorWidget) { w.deleteLines(1) }, "a\nc", 1, 0},
+		{"delete last line", "a\n  b", 1, 0, func(w *editorWidget) { w.deleteLines(1) }, "a", 0, 0},
+		{"delete only line", "abc", 0, 1, func(w *editorWidget) { w.deleteLines(1) }, "", 0, 0},
+		{"delete lines past end", "a\nb\nc", 1, 0, func(w *editorWidget) { w.deleteLines(5) }, "a", 0, 0},
+		{"join line", "a\n  b\nc", 0, 0, func(w *editorWidget) { w.joinLine() }, "a b\nc", 0, 1},
+		{"join empty line", "a\n\nb", 0, 0, func(w *editorWidget) { w.joinLine() }, "a\nb", 0, 1},
+		{"join last line", "a\nb", 1, 0, func(w *editorWidget) { w.joinLine() }, "a\nb", 1, 0},
+		{"move row keeps column", "abcdef\nab\nabcdef", 0, 5, func(w *editorWidget) {
+			w.moveRow(1)
+			w.moveRow(1)
+		}, "abcdef\nab\nabcdef", 2, 5},
+		{"move row past end", "ab\ncd", 0, 1, func(w *editorWidget) { w.moveRow(5) }, "ab\ncd", 1, 1},
+		{"move row past start", "ab\ncd", 1, 1, func(w *editorWidget) { w.moveRow(-5) }, "ab\ncd", 0, 1},
+		{"move row within wrapped line", strings.Repeat("x", 100) + "\nabc", 0, 10, func(w *editorWidget) {
+			w.moveRow(1)
+		}, strings.Repeat("x", 100) + "\nabc", 0, 90},
+		{"move row out of wrapped line", strings.Repeat("x", 100) + "\nabc", 0, 10, func(w *editorWidget) {
+			w.moveRow(2)
+		}, strings.Repeat("x", 100) + "\nabc", 1, 3},
+	}
+
+	for _, tc := range tests {
+		var w editorWidget
+		w.SetText(tc.text, false, false)
+		w.row, w.col = tc.row, tc.col
+		w.goal = -1
+		tc.edit(&w)
+		require.Equal(t, tc.want, w.Text(), tc.name)
+		require.Equal(t, tc.wantRow, w.row, tc.name)
+		require.Equal(t, tc.wantCol, w.col, tc.name)
+	}
+}
+
+func TestEditorPut(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		col     int
+		killed  string
+		want    string
+		wantRow int
+		wantCol int
+	}{
+		{"nothing killed", "abc", 1, "", "abc", 0, 1},
+		{"text after cursor", "abc", 0, "XY", "aXYbc", 0, 2},
+		{"text at line end", "abc", 2, "XY", "abcXY", 0, 4},
+		{"text in empty line", "", 0, "XY", "XY", 0, 1},
+		{"line below", "abc\ndef", 1, "  X\n", "abc\n  X\ndef", 1, 2},
+		{"lines below", "abc", 1, "X\nY\n", "abc\nX\nY", 1, 0},
+	}
+
+	for _, tc := range tests {
+		var w editorWidget
+		w.SetText(tc.text, false, false)
+		w.row, w.col = 0, tc.col
+		w.killed = tc.killed
+		w.put()
+		require.Equal(t, tc.want, w.Text(), tc.name)
+		require.Equal(t, tc.wantRow, w.row, tc.name)
+		require.Equal(t, tc.wantCol, w.col, tc.name)
+	}
+}
+
+func TestEditorKeys(t *testing.T) {
+	long := strings.Repeat("x", 100)
+	undo := gocui.KeyCtrlUnderscore
+	esc := gocui.KeyEsc
+
+	tests := []struct {
+		name     string
+		vi       bool
+		text     string
+		row, col int
+		keys     []editorKey
+		want     string
+		wantRow  int
+		wantCol  int
+	}{
+		// Emacs-style keys.
+		{"type", false, "", 0, 0, keys("ab"), "ab", 0, 2},
+		{"enter", false, "abcd", 0, 2, keys(gocui.KeyEnter), "ab\ncd", 1, 0},
+		{"backspace joins", false, "ab\ncd", 1, 0, keys(gocui.KeyBackspace2), "abcd", 0, 2},
+		{"delete joins", false, "ab\ncd", 0, 2, keys(gocui.KeyCtrlD), "abcd", 0, 2},
+		{"tab", false, "ab", 0, 2, keys(gocui.KeyTab), "ab  ", 0, 4},
+		{"kill and yank", false, "abc def", 0, 3, keys(gocui.KeyCtrlK, gocui.KeyCtrlA, gocui.KeyCtrlY), " defabc", 0, 4},
+		{"kill and yank line break", false, "ab\ncd", 0, 2, keys(gocui.KeyCtrlK, gocui.KeyCtrlY), "ab\ncd", 1, 0},
+		{"kill replaces killed text", false, "ab\ncd", 0, 0, keys(gocui.KeyCtrlK, gocui.KeyCtrlK, gocui.KeyCtrlY), "\ncd", 1, 0},
+		{"kill to line start", false, "abc def", 0, 4, keys(gocui.KeyCtrlU), "def", 0, 0},
+		{"kill word backward", false, "foo bar", 0, 7, keys(gocui.KeyCtrlW), "foo ", 0, 4},
+		{"kill word forward", false, "foo bar", 0, 3, keys(editorKey{ch: 'd', mod: gocui.ModAlt}), "foo", 0, 3},
+		{"line end and start", false, "abc\ndef", 1, 1, keys(gocui.KeyCtrlE, "X", gocui.KeyCtrlA, "Y"), "abc\nYdefX", 1, 1},
+		{"down keeps column", false, "abcdef\nab\nabcdef", 0, 5, keys(gocui.KeyCtrlN, gocui.KeyCtrlN), "abcdef\nab\nabcdef", 2, 5},
+		{"down and up in wrapped line", false, long + "\nabc", 0, 10, keys(gocui.KeyCtrlN, gocui.KeyCtrlN, gocui.KeyCtrlP), long + "\nabc", 0, 90},
+		{"forward crosses lines", false, "ab\ncd", 0, 2, keys(gocui.KeyCtrlF), "ab\ncd", 1, 0},
+		{"undo typing", false, "", 0, 0, keys("abc", undo), "", 0, 0},
+		{"undo after line break", false, "", 0, 0, keys("ab", gocui.KeyEnter, "c", undo), "ab\n", 1, 0},
+		{"undo twice", false, "", 0, 0, keys("ab", gocui.KeyEnter, "c", undo, undo), "", 0, 0},
+		{"undo join", false, "ab\ncd", 0, 2, keys(gocui.KeyCtrlK, undo), "ab\ncd", 0, 2},
+		{"undo yanked lines", false, "a\nb", 0, 0, keys(gocui.KeyCtrlK, gocui.KeyCtrlK, gocui.KeyCtrlY, gocui.KeyCtrlY, undo), "\nb", 1, 0},
+		{"undo nothing", false, "abc", 0, 1, keys(undo), "abc", 0, 1},
+
+		// Motions.
+		{"word", true, "foo bar baz", 0, 0, keys("w"), "foo bar baz", 0, 4},
+		{"words", true, "foo bar baz", 0, 0, keys("2w"), "foo bar baz", 0, 8},
+		{"word end", true, "foo bar baz", 0, 0, keys("e"), "foo bar baz", 0, 2},
+		{"word across lines", true, "foo\nbar", 0, 1, keys("w"), "foo\nbar", 1, 0},
+		{"words backward", true, "foo bar baz", 0, 10, keys("2b"), "foo bar baz", 0, 4},
+		{"right", true, "foo bar", 0, 0, keys("3l"), "foo bar", 0, 3},
+		{"right stops at line end", true, "foo", 0, 0, keys("10l"), "foo", 0, 2},
+		{"left", true, "foo bar", 0, 5, keys("2h"), "foo bar", 0, 3},
+		{"line end", true, "foo bar", 0, 0, keys("$"), "foo bar", 0, 6},
+		{"line start", true, "  foo", 0, 4, keys("0"), "  foo", 0, 0},
+		{"first non-blank", true, "  foo", 0, 4, keys("^"), "  foo", 0, 2},
+		{"down", true, "a\nb\nc\nd", 0, 0, keys("2j"), "a\nb\nc\nd", 2, 0},
+		{"up", true, "a\nb\nc\nd", 3, 0, keys("3k"), "a\nb\nc\nd", 0, 0},
+		{"last line", true, "a\n  b", 0, 0, keys("G"), "a\n  b", 1, 2},
+		{"line number", true, "a\nb\nc\nd", 0, 0, keys("3G"), "a\nb\nc\nd", 2, 0},
+		{"first line", true, "a\nb\nc\nd", 3, 0, keys("gg"), "a\nb\nc\nd", 0, 0},
+		{"second line", true, "a\nb\nc\nd", 3, 0, keys("2gg"), "a\nb\nc\nd", 1, 0},
+		{"escape clears count", true, "abc", 0, 0, keys("2", esc, "l"), "abc", 0, 1},
+
+		// Edits.
+		{"delete runes", true, "abcdef", 0, 1, keys("2x"), "adef", 0, 1},
+		{"delete runes at line end", true, "abcdef", 0, 4, keys("3x"), "abcd", 0, 3},
+		{"delete runes backward", true, "abcdef", 0, 3, keys("2X"), "adef", 0, 1},
+		{"delete line", true, "a\nb\nc", 1, 0, keys("dd"), "a\nc", 1, 0},
+		{"delete lines", true, "a\nb\nc", 0, 0, keys("2dd"), "c", 0, 0},
+		{"cancel delete", true, "abc", 0, 0, keys("dx"), "abc", 0, 0},
+		{"move line down", true, "a\nb\nc", 0, 0, keys("ddp"), "b\na\nc", 1, 0},
+		{"move lines down", true, "a\nb\nc", 0, 0, keys("2ddp"), "c\na\nb", 1, 0},
+		{"kill to line end and put", true, "abc def", 0, 3, keys("D0p"), "a defbc", 0, 4},
+		{"put at line end", true, "abc", 0, 2, keys("Dp"), "abc", 0, 2},
+		{"put twice", true, "a\nb", 0, 0, keys("dd2p"), "b\na\na", 2, 0},
+		{"join", true, "a\n  b\nc", 0, 0, keys("J"), "a b\nc", 0, 1},
+		{"join three lines", true, "a\nb\nc\nd", 0, 0, keys("3J"), "a b c\nd", 0, 3},
+		{"open below", true, "a\nb", 0, 0, keys("ox", esc), "a\nx\nb", 1, 0},
+		{"open above", true, "a\nb", 0, 0, keys("Ox", esc), "x\na\nb", 0, 0},
+		{"append", true, "ab", 0, 0, keys("aX", esc), "aXb", 0, 1},
+		{"append at line end", true, "ab", 0, 0, keys("Ac", esc), "abc", 0, 2},
+		{"insert at first non-blank", true, "  ab", 0, 3, keys("Ix", esc), "  xab", 0, 2},
+
+		// Undo.
+		{"undo insert", true, "", 0, 0, keys("iab", esc, "u"), "", 0, 0},
+		{"undo insert of lines", true, "a", 0, 0, keys("ox", gocui.KeyEnter, "y", esc, "u"), "a", 0, 0},
+		{"undo deleted lines", true, "a\nb\nc", 1, 0, keys("2dd", "u"), "a\nb\nc", 1, 0},
+		{"undo put lines", true, "a\nb\nc", 0, 0, keys("2ddp", "u"), "c", 0, 0},
+		{"undo join", true, "a\nb", 0, 0, keys("J", "u"), "a\nb", 0, 0},
+		{"undo each change", true, "abc", 0, 0, keys("xx", "u"), "bc", 0, 0},
+		{"undo all changes", true, "abc", 0, 0, keys("xx", "uu"), "abc", 0, 0},
+		{"undo in insert mode", true, "", 0, 0, keys("iab", undo), "", 0, 0},
+		{"undo nothing", true, "abc", 0, 1, keys("u"), "abc", 0, 1},
+	}
+
+	for _, tc := range tests {
+		var w editorWidget
+		w.SetText(tc.text, tc.vi, false)
+		w.row, w.col = tc.row, tc.col
+		for _, k := range tc.keys {
+			require.True(t, w.edit(nil, k.key, k.ch, k.mod), tc.name)
+		}
+		require.Equal(t, tc.want, w.Text(), tc.name)
+		row, col := w.Position()
+		require.Equal(t, tc.wantRow+1, row, tc.name)
+		require.Equal(t, tc.wantCol+1, col, tc.name)
+	}
+}
+
+func TestEditorLeavesKeys(t *testing.T) {
+	var w editorWidget
+	require.Nil(t, w.SetBoundKeys([]string{"Ctrl-S", "Ctrl-G"}))
+	w.SetText("abc", false, false)
+
+	require.False(t, w.edit(nil, gocui.KeyCtrlS, 0, gocui.ModNone))
+	require.False(t, w.edit(nil, gocui.KeyCtrlC, 0, gocui.ModNone))
+	require.True(t, w.edit(nil, gocui.KeyCtrlK, 0, gocui.ModNone))
+	require.Equal(t, "abc", w.Text())
+}
+
+func TestEditorQuit(t *testing.T) {
+	tests := []struct {
+		keys string
+		quit bool
+		save bool
+	}{
+		{"ZZ", true, true},
+		{"ZQ", true, false},
+		{"Zx", false, false},
+	}
+
+	for _, tc := range tests {
+		var w editorWidget
+		quit, save := false, false
+		w.done = func(s bool) { quit, save = true, s }
+		w.SetText("abc", true, false)
+		for _, k := range keys(tc.keys) {
+			w.edit(nil, k.key, k.ch, k.mod)
+		}
+		require.Equal(t, tc.quit, quit, tc.keys)
+		require.Equal(t, tc.save, save, tc.keys)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/tomyl/mort
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.0
 	github.com/mattn/go-runewidth v0.0.8 // indirect
 	github.com/mattn/go-sqlite3 v2.0.2+incompatible
 	github.com/nsf/termbox-go v0.0.0-20191229070316-58d4fcbce2a7 // indirect
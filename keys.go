@@ -0,0 +1,674 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/xui"
+)
+
+// A keyAction is a named operation that can be bound to keys, e.g.
+// task.clockin. Keys can be overridden in the keys section of the config.
+type keyAction struct {
+	name string
+
+	// view is the view the action is bound in. Empty means all views.
+	view string
+
+	// keys are the default keys, see parseKey.
+	keys []string
+
+	help    string
+	handler func(app *mortApp, g *gocui.Gui) error
+}
+
+// do adapts functions that report errors through the status line.
+func do(f func(app *mortApp, g *gocui.Gui)) func(app *mortApp, g *gocui.Gui) error {
+	return func(app *mortApp, g *gocui.Gui) error {
+		f(app, g)
+		return nil
+	}
+}
+
+var keyActions = append([]*keyAction{
+	// Global
+	{"app.help", "", []string{"F1", "1"}, "This help screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showHelpView()
+	})},
+	{"app.tasks", "", []string{"F2", "2"}, "Task screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showTasksView()
+	})},
+	{"app.timesheet", "", []string{"F3", "3"}, "Timesheet screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showTimesheetView()
+	})},
+	{"app.board", "", []string{"F4", "4"}, "Board screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showBoardView()
+	})},
+	{"app.projects", "", []string{"F5", "5"}, "Projects screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showProjectsView()
+	})},
+	{"app.views", "", []string{"F6", "6"}, "Saved views screen.", do(func(app *mortApp, g *gocui.Gui) {
+		app.showViewsView()
+	})},
+	{"app.profile", "", []string{"P"}, "Switch profile.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editProfile(g)
+	})},
+	{"app.quit", "", []string{"Ctrl-C"}, "Exit mort.", func(app *mortApp, g *gocui.Gui) error {
+		app.quitEditor()
+		return gocui.ErrQuit
+	}},
+	{"app.cancel", "", []string{"Ctrl-G"}, "Cancel current operation.", do(func(app *mortApp, g *gocui.Gui) {
+	})},
+	{"app.undo", "", []string{"u"}, "Undo last change.", do(func(app *mortApp, g *gocui.Gui) {
+		app.undoChange(g)
+	})},
+	{"app.redo", "", []string{"Ctrl-R"}, "Redo last undone change.", do(func(app *mortApp, g *gocui.Gui) {
+		app.redoChange(g)
+	})},
+	{"app.redraw", "", []string{"Ctrl-L"}, "Redraw screen.", func(app *mortApp, g *gocui.Gui) error {
+		return app.layout(g)
+	}},
+
+	// Tasks
+	{"task.previous", "tasks", []string{"Up"}, "Select previous task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.tasks.HandleAction(xui.ActionPreviousLine)
+	}},
+	{"task.next", "tasks", []string{"Down"}, "Select next task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.tasks.HandleAction(xui.ActionNextLine)
+	}},
+	{"task.previous-page", "tasks", []string{"PgUp"}, "Scroll up one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.tasks.HandleAction(xui.ActionPreviousPage)
+	}},
+	{"task.next-page", "tasks", []string{"PgDn"}, "Scroll down one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.tasks.HandleAction(xui.ActionNextPage)
+	}},
+	{"task.new", "tasks", []string{"Ctrl-N"}, "Create new task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.newTask(g, nil)
+	}},
+	{"task.new-subtask", "tasks", []string{"N"}, "Create new subtask of selected task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.newSubtask(g)
+	}},
+	{"task.edit", "tasks", []string{"Enter"}, "Edit selected task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.editCurrentTask(g, nil)
+	}},
+	{"task.open", "tasks", []string{"v"}, "Run the open command on selected task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.openCurrentTask()
+	})},
+	{"task.search-title", "tasks", []string{"/"}, "Fuzzy search task titles, including projects, narrowing the list as you type.", do(func(app *mortApp, g *gocui.Gui) {
+		app.searchTitle(g)
+	})},
+	{"task.search-body", "tasks", []string{"s"}, "Search task bodies.", do(func(app *mortApp, g *gocui.Gui) {
+		app.searchBody(g)
+	})},
+	{"task.edit-query", "tasks", []string{"f"}, "Edit task query, e.g. project:acme state:TODO,WAIT -archived.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editQuery(g)
+	})},
+	{"task.toggle-range", "tasks", []string{"w"}, "Toggle between day and week view.", do(func(app *mortApp, g *gocui.Gui) {
+		app.toggleTasksDateRange()
+		app.loadTasks()
+	})},
+	{"task.previous-range", "tasks", []string{"Left"}, "Go to previous day/week.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Range.Prev()
+		app.loadTasks()
+	})},
+	{"task.next-range", "tasks", []string{"Right"}, "Go to next day/week.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Range.Next()
+		app.loadTasks()
+	})},
+	{"task.edit-estimate", "tasks", []string{"e"}, "Set time estimate of selected task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editEstimate(g)
+	})},
+	{"task.cycle-state", "tasks", []string{"Ctrl-T"}, "Cycle todo state of selected task forward.", do(func(app *mortApp, g *gocui.Gui) {
+		app.cycleTodoState(1)
+	})},
+	{"task.cycle-state-back", "tasks", []string{"T"}, "Cycle todo state of selected task backward.", do(func(app *mortApp, g *gocui.Gui) {
+		app.cycleTodoState(-1)
+	})},
+	{"task.set-state", "tasks", []string{"S"}, "Set todo state of selected or marked tasks, e.g. WAIT or none.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editTodoState(g)
+	})},
+	{"task.toggle-todo", "tasks", []string{"t"}, "Toggle display of todo tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Filter.Todo = !app.Filter.Todo
+		app.loadTasks()
+	})},
+	{"task.archive", "tasks", []string{"Ctrl-X"}, "Archive selected or marked tasks, or unarchive them.", func(app *mortApp, g *gocui.Gui) error {
+		return app.toggleArchived()
+	}},
+	{"task.set-project", "tasks", []string{"r"}, "Move selected or marked tasks to another project.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editProject(g)
+	})},
+	{"task.delete", "tasks", []string{"Delete"}, "Delete selected or marked tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.deleteTasks(g)
+	})},
+	{"task.toggle-mark", "tasks", []string{".", "Insert"}, "Mark or unmark selected task and move down.", func(app *mortApp, g *gocui.Gui) error {
+		app.tasks.ToggleMark()
+		app.showTasksQuery()
+		return app.tasks.HandleAction(xui.ActionNextLine)
+	}},
+	{"task.mark-all", "tasks", []string{"*"}, "Mark all listed tasks, or unmark them if all are marked.", do(func(app *mortApp, g *gocui.Gui) {
+		app.tasks.MarkAll()
+		app.showTasksQuery()
+	})},
+	{"task.invert-marks", "tasks", []string{"~"}, "Invert marks of listed tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.tasks.InvertMarks()
+		app.showTasksQuery()
+	})},
+	{"task.toggle-archived", "tasks", []string{"x"}, "Toggle display of archived tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Filter.Archived = !app.Filter.Archived
+		app.loadTasks()
+	})},
+	{"task.filter-project", "tasks", []string{"p"}, "Toggle project filter.", do(func(app *mortApp, g *gocui.Gui) {
+		app.toggleProjectFilter()
+		app.loadTasks()
+	})},
+	{"task.filter-parent", "tasks", []string{"d"}, "Toggle filter on selected task and its descendants.", do(func(app *mortApp, g *gocui.Gui) {
+		app.toggleParentFilter()
+		app.loadTasks()
+	})},
+	{"task.move", "tasks", []string{"m"}, "Move selected task under another task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editParent(g)
+	})},
+	{"task.detach", "tasks", []string{"M"}, "Make selected task a top-level task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.detachTask()
+	})},
+	{"task.cycle-sort", "tasks", []string{"o"}, "Cycle sort order (updated, created, scheduled, project, state, title, spent).", do(func(app *mortApp, g *gocui.Gui) {
+		app.cycleSort()
+	})},
+	{"task.reverse-sort", "tasks", []string{"O"}, "Reverse sort order.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Filter.Reverse = !app.Filter.Reverse
+		app.loadTasks()
+	})},
+	{"task.toggle-tree", "tasks", []string{"z"}, "Toggle tree of parent and child tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.tasks.SetTree(!app.tasks.Tree())
+		app.loadTasks()
+	})},
+	{"task.toggle-collapsed", "tasks", []string{"Space"}, "Collapse or expand selected task in tree.", do(func(app *mortApp, g *gocui.Gui) {
+		app.tasks.ToggleCollapsed()
+	})},
+	{"task.save-view", "tasks", []string{"W"}, "Save filters and search as a view.", do(func(app *mortApp, g *gocui.Gui) {
+		app.saveView(g)
+	})},
+	{"task.reset-filters", "tasks", []string{"q"}, "Reset filters.", do(func(app *mortApp, g *gocui.Gui) {
+		app.resetFilters()
+	})},
+	{"task.reload", "tasks", []string{"Ctrl-L"}, "Reload tasks.", do(func(app *mortApp, g *gocui.Gui) {
+		app.loadTasks()
+	})},
+	{"task.clockin", "tasks", []string{"c"}, "Clock in on selected task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.clockIn()
+	})},
+	{"task.clockout", "tasks", []string{"Ctrl-O"}, "Clock out from currently active task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.clockOut()
+	})},
+	{"task.goto-active", "tasks", []string{"i"}, "Jump to active task.", do(func(app *mortApp, g *gocui.Gui) {
+		app.goToActive()
+	})},
+	{"task.toggle-preview", "tasks", []string{"Ctrl-P"}, "Show or hide the preview pane.", func(app *mortApp, g *gocui.Gui) error {
+		return app.togglePreview(g)
+	}},
+	{"task.preview-down", "tasks", []string{"Ctrl-D"}, "Scroll preview down half a page.", do(func(app *mortApp, g *gocui.Gui) {
+		app.preview.ScrollPage(1)
+	})},
+	{"task.preview-up", "tasks", []string{"Ctrl-U"}, "Scroll preview up half a page.", do(func(app *mortApp, g *gocui.Gui) {
+		app.preview.ScrollPage(-1)
+	})},
+
+	// Timesheet
+	{"timesheet.previous", "timesheet", []string{"Up"}, "Select previous entry.", func(app *mortApp, g *gocui.Gui) error {
+		return app.timesheet.HandleAction(xui.ActionPreviousLine)
+	}},
+	{"timesheet.next", "timesheet", []string{"Down"}, "Select next entry.", func(app *mortApp, g *gocui.Gui) error {
+		return app.timesheet.HandleAction(xui.ActionNextLine)
+	}},
+	{"timesheet.previous-page", "timesheet", []string{"PgUp"}, "Scroll up one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.timesheet.HandleAction(xui.ActionPreviousPage)
+	}},
+	{"timesheet.next-page", "timesheet", []string{"PgDn"}, "Scroll down one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.timesheet.HandleAction(xui.ActionNextPage)
+	}},
+	{"timesheet.edit", "timesheet", []string{"Enter"}, "Edit task of selected entry.", func(app *mortApp, g *gocui.Gui) error {
+		return app.editCurrentTimesheetTask(g, nil)
+	}},
+	{"timesheet.open", "timesheet", []string{"v"}, "Run the open command on task of selected entry.", do(func(app *mortApp, g *gocui.Gui) {
+		app.openCurrentTimesheetTask()
+	})},
+	{"timesheet.toggle-range", "timesheet", []string{"w"}, "Toggle between day and week view.", do(func(app *mortApp, g *gocui.Gui) {
+		app.toggleTimesheetDateRange()
+		app.loadTimesheet()
+	})},
+	{"timesheet.previous-range", "timesheet", []string{"Left"}, "Go to previous day/week.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Range.Prev()
+		app.loadTimesheet()
+	})},
+	{"timesheet.next-range", "timesheet", []string{"Right"}, "Go to next day/week.", do(func(app *mortApp, g *gocui.Gui) {
+		app.Range.Next()
+		app.loadTimesheet()
+	})},
+	{"timesheet.edit-clockin", "timesheet", []string{"i"}, "Edit clockin time.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editClockin(g)
+	})},
+	{"timesheet.edit-clockout", "timesheet", []string{"o"}, "Edit clockout time.", do(func(app *mortApp, g *gocui.Gui) {
+		app.editClockout(g)
+	})},
+	{"timesheet.reload", "timesheet", []string{"Ctrl-L"}, "Reload timesheet.", do(func(app *mortApp, g *gocui.Gui) {
+		app.loadTimesheet()
+	})},
+
+	// Board
+	{"board.previous", "board", []string{"Up"}, "Select previous card.", do(func(app *mortApp, g *gocui.Gui) {
+		app.board.MoveRow(-1)
+	})},
+	{"board.next", "board", []string{"Down"}, "Select next card.", do(func(app *mortApp, g *gocui.Gui) {
+		app.board.MoveRow(1)
+	})},
+	{"board.left", "board", []string{"Left"}, "Select card in previous column.", do(func(app *mortApp, g *gocui.Gui) {
+		app.board.MoveColumn(-1)
+	})},
+	{"board.right", "board", []string{"Right"}, "Select card in next column.", do(func(app *mortApp, g *gocui.Gui) {
+		app.board.MoveColumn(1)
+	})},
+	{"board.move-left", "board", []string{"<"}, "Move selected card to previous column, changing its state.", do(func(app *mortApp, g *gocui.Gui) {
+		app.moveCard(-1)
+	})},
+	{"board.move-right", "board", []string{">"}, "Move selected card to next column, changing its state.", do(func(app *mortApp, g *gocui.Gui) {
+		app.moveCard(1)
+	})},
+	{"board.move-up", "board", []string{"K"}, "Move selected card up within its column.", do(func(app *mortApp, g *gocui.Gui) {
+		app.moveCardWithinColumn(-1)
+	})},
+	{"board.move-down", "board", []string{"J"}, "Move selected card down within its column.", do(func(app *mortApp, g *gocui.Gui) {
+		app.moveCardWithinColumn(1)
+	})},
+	{"board.edit", "board", []string{"Enter"}, "Edit selected task.", func(app *mortApp, g *gocui.Gui) error {
+		return app.editCurrentBoardTask(g)
+	}},
+	{"board.reload", "board", []string{"Ctrl-L"}, "Reload board.", do(func(app *mortApp, g *gocui.Gui) {
+		app.loadBoard()
+	})},
+
+	// Projects
+	{"projects.previous", "projects", []string{"Up"}, "Select previous project.", func(app *mortApp, g *gocui.Gui) error {
+		return app.projects.HandleAction(xui.ActionPreviousLine)
+	}},
+	{"projects.next", "projects", []string{"Down"}, "Select next project.", func(app *mortApp, g *gocui.Gui) error {
+		return app.projects.HandleAction(xui.ActionNextLine)
+	}},
+	{"projects.previous-page", "projects", []string{"PgUp"}, "Scroll up one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.projects.HandleAction(xui.ActionPreviousPage)
+	}},
+	{"projects.next-page", "projects", []string{"PgDn"}, "Scroll down one page.", func(app *mortApp, g *gocui.Gui) error {
+		return app.projects.HandleAction(xui.ActionNextPage)
+	}},
+	{"projects.open", "projects", []string{"Enter"}, "Show tasks of selected project.", do(func(app *mortApp, g *gocui.Gui) {
+		app.openProject()
+	})},
+	{"projects.reload", "projects", []string{"Ctrl-L"}, "Reload projects.", do(func(app *mortApp, g *gocui.Gui) {
+		app.loadProjects()
+	})},
+
+	// Views
+	{"views.previous", "views", []string{"Up"}, "Select previous view.", func(app *mortApp, g *gocui.Gui) error {
+		return app.views.HandleAction(xui.ActionPreviousLine)
+	}},
+	{"views.next", "views", []string{"Down"}, "Select next view.", func(app *mortApp, g *gocui.Gui) error {
+		return app.views.HandleAction(xui.ActionNextLine)
+	}},
+	{"views.open", "views", []string{"Enter"}, "Show tasks of selected view.", do(func(app *mortApp, g *gocui.Gui) {
+		app.openView()
+	})},
+	{"views.delete", "views", []string{"Delete"}, "Delete selected view.", do(func(app *mortApp, g *gocui.Gui) {
+		app.deleteView(g)
+	})},
+	{"views.reload", "views", []string{"Ctrl-L"}, "Reload views.", do(func(app *mortApp, g *gocui.Gui) {
+		app.loadViews()
+	})},
+
+	// Editor
+	{"editor.save", "editor", []string{"Ctrl-S"}, "Save and close the editor.", do(func(app *mortApp, g *gocui.Gui) {
+		app.closeEditor(g, true)
+	})},
+	{"editor.cancel", "editor", []string{"Ctrl-G"}, "Close the editor without saving. The draft of a new task is kept.", do(func(app *mortApp, g *gocui.Gui) {
+		app.closeEditor(g, false)
+	})},
+	{"editor.external", "editor", []string{"Ctrl-X"}, "Continue editing in the external editor.", func(app *mortApp, g *gocui.Gui) error {
+		return app.externalEditor()
+	}},
+}, recallViewActions()...)
+
+// recallViewActions returns actions that recall the first nine views by
+// number in the views screen. The number keys switch screens elsewhere.
+func recallViewActions() []*keyAction {
+	actions := make([]*keyAction, 0, 9)
+
+	for i := 1; i <= 9; i++ {
+		n := i
+		actions = append(actions, &keyAction{
+			name: fmt.Sprintf("views.recall-%d", n),
+			view: "views",
+			keys: []string{fmt.Sprintf("%d", n)},
+			help: fmt.Sprintf("Show tasks of view %d.", n),
+			handler: do(func(app *mortApp, g *gocui.Gui) {
+				app.recallView(n)
+			}),
+		})
+	}
+
+	return actions
+}
+
+// keyViews are the views with keybindings in help screen order.
+var keyViews = []struct {
+	name  string
+	title string
+}{
+	{"", "Global keybindings"},
+	{"tasks", "Task view keybindings"},
+	{"timesheet", "Timesheet view keybindings"},
+	{"board", "Board view keybindings"},
+	{"projects", "Projects view keybindings"},
+	{"views", "Saved views keybindings"},
+	{"editor", "Editor keybindings"},
+}
+
+// keyNotes are shown after the keybindings of a view in the help screen.
+var keyNotes = map[string][]string{
+	"editor": {
+		"",
+		"Text is edited with Emacs-style keys: Ctrl-A/E line start/end, Ctrl-F/B/N/P",
+		"or arrows to move, Alt-f/b by word, Ctrl-V/Alt-v or PgDn/PgUp by page,",
+		"Alt-</> to the start/end, Ctrl-D delete, Ctrl-K/U kill to line end/start,",
+		"Ctrl-W/Alt-d kill word, Ctrl-Y yank and Ctrl-_ undo.",
+		"",
+		"With edit.vi set in the config, Esc enters a vi-style normal mode with",
+		"h j k l 0 ^ $ w b e gg G x X dd D p J, counts as in 3j or 2dd, u to undo,",
+		"i a I A o O to insert again, and ZZ or ZQ to save or cancel. Esc is then",
+		"passed on at once, so Alt keys don't work at all, in insert mode or",
+		"elsewhere in mort.",
+	},
+}
+
+func getKeyAction(name string) *keyAction {
+	for _, a := range keyActions {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// defaultKeys returns the default keys of all actions.
+func defaultKeys() map[string]keyList {
+	keys := make(map[string]keyList, len(keyActions))
+	for _, a := range keyActions {
+		keys[a.name] = append(keyList(nil), a.keys...)
+	}
+	return keys
+}
+
+// keyList is a list of key names. In the config it can also be given as a
+// single string.
+type keyList []string
+
+func (l *keyList) UnmarshalTOML(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		*l = keyList{v}
+		return nil
+	case []interface{}:
+		keys := make(keyList, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("expected key name, got %v", item)
+			}
+			keys = append(keys, s)
+		}
+		*l = keys
+		return nil
+	}
+	return fmt.Errorf("expected key name or list of key names, got %v", v)
+}
+
+var namedKeys = map[string]gocui.Key{
+	"f1":        gocui.KeyF1,
+	"f2":        gocui.KeyF2,
+	"f3":        gocui.KeyF3,
+	"f4":        gocui.KeyF4,
+	"f5":        gocui.KeyF5,
+	"f6":        gocui.KeyF6,
+	"f7":        gocui.KeyF7,
+	"f8":        gocui.KeyF8,
+	"f9":        gocui.KeyF9,
+	"f10":       gocui.KeyF10,
+	"f11":       gocui.KeyF11,
+	"f12":       gocui.KeyF12,
+	"insert":    gocui.KeyInsert,
+	"delete":    gocui.KeyDelete,
+	"home":      gocui.KeyHome,
+	"end":       gocui.KeyEnd,
+	"pgup":      gocui.KeyPgup,
+	"pgdn":      gocui.KeyPgdn,
+	"up":        gocui.KeyArrowUp,
+	"down":      gocui.KeyArrowDown,
+	"left":      gocui.KeyArrowLeft,
+	"right":     gocui.KeyArrowRight,
+	"enter":     gocui.KeyEnter,
+	"tab":       gocui.KeyTab,
+	"esc":       gocui.KeyEsc,
+	"space":     gocui.KeySpace,
+	"backspace": gocui.KeyBackspace2,
+}
+
+// parseKey parses key names such as x, T, /, F1, Enter, Ctrl-T or Alt-x.
+// Note that terminals can't tell some keys apart, e.g. Ctrl-I and Tab.
+func parseKey(s string) (interface{}, gocui.Modifier, error) {
+	mod := gocui.ModNone
+	name := s
+
+	if len(name) > 4 && strings.EqualFold(name[:4], "alt-") {
+		mod = gocui.ModAlt
+		name = name[4:]
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		ch, _ := utf8.DecodeRuneInString(name)
+		if ch == ' ' {
+			return gocui.KeySpace, mod, nil
+		}
+		return ch, mod, nil
+	}
+
+	if key, ok := namedKeys[strings.ToLower(name)]; ok {
+		return key, mod, nil
+	}
+
+	if len(name) == 6 && strings.EqualFold(name[:5], "ctrl-") {
+		ch := name[5]
+		if ch >= 'A' && ch <= 'Z' {
+			ch += 'a' - 'A'
+		}
+		if ch >= 'a' && ch <= 'z' {
+			return gocui.Key(ch - 'a' + 1), mod, nil
+		}
+	}
+
+	return nil, mod, fmt.Errorf("unknown key %q", s)
+}
+
+// validateKeys checks that keys only refer to known actions and keys, and
+// that no key is bound twice in the same view.
+func validateKeys(keys map[string]keyList) error {
+	names := make([]string, 0, len(keys))
+	for name := range keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if getKeyAction(name) == nil {
+			return fmt.Errorf("keys: unknown action %q", name)
+		}
+	}
+
+	type binding struct {
+		view string
+		key  interface{}
+		mod  gocui.Modifier
+	}
+
+	bound := make(map[binding]string)
+
+	for _, a := range keyActions {
+		for _, s := range keys[a.name] {
+			key, mod, err := parseKey(s)
+			if err != nil {
+				return fmt.Errorf("keys.%q: %v", a.name, err)
+			}
+			b := binding{a.view, key, mod}
+			if other, ok := bound[b]; ok && other != a.name {
+				return fmt.Errorf("keys.%q: %s is already bound to %s", a.name, s, other)
+			}
+			bound[b] = a.name
+		}
+	}
+
+	return nil
+}
+
+// shadowedKeys returns warnings about keys of a view that hide a global key
+// of another action in that view. Keys that are both defaults aren't
+// reported since some views are meant to override global keys, e.g. Ctrl-L.
+func shadowedKeys(keys map[string]keyList) []string {
+	defaults := defaultKeys()
+
+	isDefault := func(name, s string) bool {
+		for _, d := range defaults[name] {
+			if d == s {
+				return true
+			}
+		}
+		return false
+	}
+
+	type binding struct {
+		key interface{}
+		mod gocui.Modifier
+	}
+
+	type global struct {
+		name string
+		key  string
+	}
+
+	globals := make(map[binding]global)
+
+	for _, a := range keyActions {
+		if a.view != "" {
+			continue
+		}
+		for _, s := range keys[a.name] {
+			if key, mod, err := parseKey(s); err == nil {
+				globals[binding{key, mod}] = global{a.name, s}
+			}
+		}
+	}
+
+	var warnings []string
+
+	for _, a := range keyActions {
+		if a.view == "" {
+			continue
+		}
+		for _, s := range keys[a.name] {
+			key, mod, err := parseKey(s)
+			if err != nil {
+				continue
+			}
+			g, ok := globals[binding{key, mod}]
+			if !ok || isDefault(a.name, s) && isDefault(g.name, g.key) {
+				continue
+			}
+			hidden := g.name
+			if g.key != s {
+				hidden += " (" + g.key + ")"
+			}
+			warnings = append(warnings, fmt.Sprintf("keys.%q: %s hides %s in the %s view", a.name, s, hidden, a.view))
+		}
+	}
+
+	return warnings
+}
+
+func (app *mortApp) registerKeys(g *gocui.Gui) error {
+	editorKeys := make([]string, 0)
+
+	for _, a := range keyActions {
+		handler := a.handler
+
+		if a.view == "editor" {
+			editorKeys = append(editorKeys, conf.Keys[a.name]...)
+		}
+
+		for _, s := range conf.Keys[a.name] {
+			key, mod, err := parseKey(s)
+			if err != nil {
+				return err
+			}
+			app.gx.SetKeybinding(a.view, key, mod, func(g *gocui.Gui, view *gocui.View) error {
+				return handler(app, g)
+			})
+		}
+	}
+
+	if err := app.editor.SetBoundKeys(editorKeys); err != nil {
+		return err
+	}
+
+	return app.gx.Err()
+}
+
+// keyHint returns the first key bound to action, or the action name if it
+// isn't bound.
+func keyHint(action string) string {
+	if keys := conf.Keys[action]; len(keys) > 0 {
+		return keys[0]
+	}
+	return action
+}
+
+// helpLines generates the help screen from the effective keybindings.
+func helpLines() []string {
+	lines := []string{"mört - a simple task manager and time tracker"}
+
+	for _, view := range keyViews {
+		rows := make([][2]string, 0)
+		width := 0
+
+		for _, a := range keyActions {
+			if a.view != view.name {
+				continue
+			}
+			keys := strings.Join(conf.Keys[a.name], ", ")
+			if keys == "" {
+				keys = "-"
+			}
+			if n := xui.StringWidth(keys); n > width {
+				width = n
+			}
+			rows = append(rows, [2]string{keys, a.help + " (" + a.name + ")"})
+		}
+
+		lines = append(lines, "", view.title, strings.Repeat("=", len(view.title)), "")
+
+		for _, row := range rows {
+			lines = append(lines, xui.Pad(row[0], width)+"  "+row[1])
+		}
+
+		lines = append(lines, keyNotes[view.name]...)
+	}
+
+	return lines
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tomyl/mort/store"
+)
+
+// taskQueryFlags registers flags for every store.TaskQuery field and for a
+// saved view. The returned function builds the query from the view or from
+// positional query arguments (see store.ParseQuery), and the flags, which take
+// precedence. It also returns the search pattern of the view, see
+// fuzzyFilter.
+func taskQueryFlags(fs *flag.FlagSet) func(db *store.Store, args []string) (store.TaskQuery, string, error) {
+	viewName := fs.String("view", "", "Start from saved view instead of a query")
+	project := fs.String("project", "", "Only tasks in project")
+	archived := fs.Bool("archived", false, "Include archived tasks")
+	title := fs.String("title", "", "Only tasks with title containing string")
+	body := fs.String("body", "", "Only tasks with body containing string")
+	todo := fs.Bool("todo", false, "Only tasks with a todo state, ordered by state")
+	open := fs.Bool("open", false, "Only tasks with a todo state that isn't done")
+	parent := fs.String("parent", "", "Only task (id or search) and its descendants")
+	rangeName := fs.String("range", "", "Only tasks created or updated within day or week")
+	date := fs.String("date", "", "Day within -range, e.g. 2006-01-02 (default today)")
+	estimated := fs.Bool("estimated", false, "Only tasks with a time estimate")
+	sort := fs.String("sort", "", "Sort order ("+strings.Join(store.SortFields(), ", ")+") (default updated)")
+	reverse := fs.Bool("reverse", false, "Reverse sort order")
+	limit := fs.Int("limit", 0, "Maximum number of tasks")
+
+	return func(db *store.Store, args []string) (store.TaskQuery, string, error) {
+		query, search, err := parseViewOrQuery(db, *viewName, args)
+
+		if err != nil {
+			return query, "", err
+		}
+
+		if *project != "" {
+			query.Project = *project
+		}
+
+		if *title != "" {
+			query.SearchTitle = *title
+		}
+
+		if *body != "" {
+			query.SearchBody = *body
+		}
+
+		if *sort != "" {
+			query.Sort = *sort
+		}
+
+		if *limit > 0 {
+			query.Limit = *limit
+		}
+
+		query.Archived = query.Archived || *archived
+		query.Todo = query.Todo || *todo
+		query.Open = query.Open || *open
+		query.Estimated = query.Estimated || *estimated
+		query.Reverse = query.Reverse != *reverse
+
+		if *parent != "" {
+			task, err := resolveTask(db, *parent)
+			if err != nil {
+				return query, "", fmt.Errorf("parent: %v", err)
+			}
+			query.ParentID = task.ID
+		}
+
+		if *rangeName != "" || *date != "" {
+			day := time.Now()
+
+			if *date != "" {
+				if day, err = parseSchedule(*date); err != nil {
+					return query, "", usagef("invalid date: %v", err)
+				}
+			}
+
+			var r store.TimeRange
+			r.Day(day)
+
+			switch *rangeName {
+			case "", "day":
+			case "week":
+				r.Week()
+			default:
+				return query, "", usagef("unknown range %q", *rangeName)
+			}
+
+			query.Range = &r
+		}
+
+		return query, search, nil
+	}
+}
+
+// parseViewOrQuery returns the query and search pattern of the named view, or
+// parses args if name is empty.
+func parseViewOrQuery(db *store.Store, name string, args []string) (store.TaskQuery, string, error) {
+	if name == "" {
+		query, err := store.ParseQueryArgs(args)
+		if err != nil {
+			return query, "", usagef("invalid query: %v", err)
+		}
+		return query, "", nil
+	}
+
+	if len(args) > 0 {
+		return store.TaskQuery{}, "", usagef("-view can't be combined with a query")
+	}
+
+	v, err := db.GetView(name)
+
+	if err != nil {
+		return store.TaskQuery{}, "", err
+	}
+
+	if v == nil {
+		return store.TaskQuery{}, "", fmt.Errorf("no view named %s", name)
+	}
+
+	query, err := v.TaskQuery()
+
+	return query, v.Search, err
+}
+
+// getTasks returns the tasks matching query and the search pattern. The limit
+// of query applies after the search.
+func getTasks(db *store.Store, query store.TaskQuery, search string) ([]store.Task, error) {
+	limit := query.Limit
+
+	if search != "" {
+		query.Limit = 0
+	}
+
+	tasks, err := db.GetTasks(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tasks = fuzzyFilter(tasks, search)
+
+	if limit > 0 && len(tasks) > limit {
+		tasks = tasks[:limit]
+	}
+
+	return tasks, nil
+}
+
+// fuzzyFilter keeps the tasks with titles matching pattern, see
+// store.FuzzyMatch, best matches first.
+func fuzzyFilter(tasks []store.Task, pattern string) []store.Task {
+	if pattern == "" {
+		return tasks
+	}
+
+	scores := make(map[int64]int)
+	found := make([]store.Task, 0)
+
+	for _, task := range tasks {
+		if score, _, ok := store.FuzzyMatch(pattern, task.Title); ok {
+			scores[task.ID] = score
+			found = append(found, task)
+		}
+	}
+
+	sort.SliceStable(found, func(a, b int) bool {
+		return scores[found[a].ID] > scores[found[b].ID]
+	})
+
+	return found
+}
+
+// A taskColumn is a column in the output of mort list.
+type taskColumn struct {
+	name   string
+	format func(task *store.Task) string
+}
+
+var taskColumns = []taskColumn{
+	{"id", func(task *store.Task) string {
+		return fmt.Sprintf("%d", task.ID)
+	}},
+	{"state", func(task *store.Task) string {
+		if task.State != nil {
+			return *task.State
+		}
+		return "-"
+	}},
+	{"created", func(task *store.Task) string {
+		return formatTimestamp(&task.CreatedAt)
+	}},
+	{"updated", func(task *store.Task) string {
+		return formatTimestamp(&task.UpdatedAt)
+	}},
+	{"scheduled", func(task *store.Task) string {
+		if task.ScheduledAt != nil {
+			return formatTimestamp(task.ScheduledAt)
+		}
+		return "-"
+	}},
+	{"parent", func(task *store.Task) string {
+		if task.ParentID != nil {
+			return fmt.Sprintf("%d", *task.ParentID)
+		}
+		return "-"
+	}},
+	{"estimate", func(task *store.Task) string {
+		if task.Estimate != nil {
+			return formatDuration(time.Duration(*task.Estimate) * time.Second)
+		}
+		return "-"
+	}},
+	{"spent", func(task *store.Task) string {
+		return formatDuration(time.Duration(task.Spent) * time.Second)
+	}},
+	{"project", func(task *store.Task) string {
+		return task.Project
+	}},
+	{"title", func(task *store.Task) string {
+		return task.Title
+	}},
+}
+
+func getTaskColumn(name string) *taskColumn {
+	for i := range taskColumns {
+		if taskColumns[i].name == name {
+			return &taskColumns[i]
+		}
+	}
+	return nil
+}
+
+func parseTaskColumns(s string) ([]*taskColumn, error) {
+	columns := make([]*taskColumn, 0)
+
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		column := getTaskColumn(name)
+		if column == nil {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		columns = append(columns, column)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns")
+	}
+
+	return columns, nil
+}
+
+func cmdListTasks(c *command, fs *flag.FlagSet) commandFunc {
+	names := make([]string, 0, len(taskColumns))
+	for _, column := range taskColumns {
+		names = append(names, column.name)
+	}
+
+	buildQuery := taskQueryFlags(fs)
+	columnList := fs.String("columns", "title", "Comma-separated columns ("+strings.Join(names, ", ")+")")
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, -1)
+
+		if err != nil {
+			return err
+		}
+
+		columns, err := parseTaskColumns(*columnList)
+
+		if err != nil {
+			return usageError{err.Error()}
+		}
+
+		query, search, err := buildQuery(db, args)
+
+		if err != nil {
+			return err
+		}
+
+		query.Spent = *asJSON || strings.Contains(*columnList, "spent")
+
+		tasks, err := getTasks(db, query, search)
+		if err != nil {
+			return fmt.Errorf("failed to get tasks: %v", err)
+		}
+
+		if *asJSON {
+			return printJSON(tasks)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', 0)
+
+		for i := range tasks {
+			fields := make([]string, len(columns))
+			for j, column := range columns {
+				fields[j] = column.format(&tasks[i])
+			}
+			fmt.Fprintln(w, strings.Join(fields, "\t"))
+		}
+
+		return w.Flush()
+	}
+}
+
+func cmdQueryTasks(c *command, fs *flag.FlagSet) commandFunc {
+	buildQuery := taskQueryFlags(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, -1)
+
+		if err != nil {
+			return err
+		}
+
+		query, search, err := buildQuery(db, args)
+
+		if err != nil {
+			return err
+		}
+
+		query.Limit = 1
+
+		tasks, err := getTasks(db, query, search)
+		if err != nil {
+			return fmt.Errorf("failed to get tasks: %v", err)
+		}
+
+		if len(tasks) == 0 {
+			return exitStatus(exitError)
+		}
+
+		return nil
+	}
+}
@@ -1,227 +1,1391 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
-	xdg "github.com/queria/golang-go-xdg"
 
 	"github.com/tomyl/mort/store"
 	"github.com/tomyl/xl"
 	"github.com/tomyl/xl/logger"
 )
 
-func cmdPauseActiveTask(db *store.Store) {
-	pausedID, err := db.GetPausedTaskID()
+// Exit codes.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
 
-	if err != nil {
-		log.Fatalln(err)
+// A command is a mort subcommand.
+type command struct {
+	name    string
+	args    string
+	summary string
+
+	// run defines the flags of the command in fs and returns the function
+	// that runs the command.
+	run func(c *command, fs *flag.FlagSet) commandFunc
+}
+
+// A commandFunc runs a command with its command-line arguments.
+type commandFunc func(db *store.Store, args []string) error
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"tui", "", "Start the interactive user interface (default).", cmdRun},
+		{"new", "[options]", "Create a new task.", cmdNewTask},
+		{"list", "[options] [query]", "List tasks matching query, e.g. project:acme state:TODO,WAIT updated:>2026-09-01 \"login bug\".", cmdListTasks},
+		{"query", "[options] [query]", "Query tasks. Exits with status 1 if no task matches. Analogous to grep --quiet.", cmdQueryTasks},
+		{"show", "<id|search>", "Show a task.", cmdShowTask},
+		{"edit", "<id|search>", "Edit a task in $EDITOR.", cmdEditTask},
+		{"clockin", "<id|search>", "Clock in on a task.", cmdClockin},
+		{"clockout", "", "Clock out from the active task.", cmdClockout},
+		{"pause", "", "Pause the active task (or clock in again on the paused task).", cmdPauseActiveTask},
+		{"clock", "", "Print the current clock-in duration.", cmdCheckinDurationActive},
+		{"today", "", "Print the total clock-in duration today.", cmdCheckinDurationToday},
+		{"status", "[options]", "Print the clock state for status bars using a template.", cmdStatus},
+		{"timesheet", "[options]", "Print the timesheet for today or this week.", cmdTimesheet},
+		{"state", "<id|search> <state>", "Set the todo state of a task, or none to clear it.", cmdSetState},
+		{"archive", "<id|search>", "Archive a task.", cmdArchive},
+		{"unarchive", "<id|search>", "Unarchive a task.", cmdUnarchive},
+		{"estimate", "<id|search> <duration>", "Set the time estimate of a task, e.g. 1h30m or 01:30. Use 0 to clear.", cmdSetEstimate},
+		{"parent", "<id|search> <id|search|none>", "Move a task under another task, or none to make it a top-level task.", cmdSetParent},
+		{"estimates", "[options]", "Report estimated vs clocked time.", cmdEstimateReport},
+		{"projects", "[options]", "List projects with task counts and time clocked this week and month.", cmdProjects},
+		{"views", "[options] [query]", "List saved views, or save query as a view with -save. Use a view with mort list -view.", cmdViews},
+		{"init", "[dir]", "Create a task database in dir/.mort (default current directory). It is used instead of the default profile's database in dir and its subdirectories.", cmdInit},
+		{"profiles", "", "List profiles. The current profile is marked with *.", cmdProfiles},
+		{"config", "[options]", "Print the effective configuration.", cmdConfig},
+		{"help", "[command]", "Show help for a command.", nil},
 	}
+}
 
-	if pausedID > 0 {
-		if err := db.Clockin(pausedID); err != nil {
-			log.Fatalln(err)
+func getCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
 		}
-		cmdCheckinDurationActive(db)
-	} else {
-		activeID, err := db.GetActiveTaskID()
-		if err != nil {
-			log.Fatalln(err)
+	}
+	return nil
+}
+
+// usageError indicates that a command was invoked incorrectly.
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+func usagef(pat string, params ...interface{}) error {
+	return usageError{fmt.Sprintf(pat, params...)}
+}
+
+// exitStatus makes mort exit with a specific status without printing anything.
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {}
+	return fs
+}
+
+func (c *command) usage(fs *flag.FlagSet) {
+	w := os.Stderr
+	fmt.Fprintf(w, "Usage: mort %s %s\n\n%s\n", c.name, c.args, c.summary)
+
+	if fs != nil {
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(w, "\nOptions:\n")
+			fs.SetOutput(w)
+			fs.PrintDefaults()
 		}
-		if activeID > 0 {
-			if _, err := db.Pause(); err != nil {
-				log.Fatalln(err)
+	}
+}
+
+// parse parses command-line flags, which may be interspersed with positional
+// arguments, and verifies the number of positional arguments.
+func (c *command) parse(fs *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	fs.SetOutput(ioutil.Discard)
+
+	positional := make([]string, 0)
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			if err == flag.ErrHelp {
+				c.usage(fs)
+				return nil, err
 			}
-			cmdCheckinDurationActive(db)
+			return nil, usageError{err.Error()}
+		}
+
+		rest := fs.Args()
+
+		if len(rest) == 0 {
+			break
+		}
+
+		if len(args) > len(rest) && args[len(args)-len(rest)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	if len(positional) < minArgs {
+		return nil, usagef("too few arguments")
+	}
+
+	if maxArgs >= 0 && len(positional) > maxArgs {
+		return nil, usagef("too many arguments")
+	}
+
+	return positional, nil
+}
+
+func usage() {
+	w := os.Stderr
+	fmt.Fprintf(w, "Usage: mort [--profile name] [command] [options] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nThe profile selects a separate database, drafts and log (default $MORT_PROFILE or %s).\n", store.DefaultProfile)
+	fmt.Fprintf(w, "\nRun 'mort help <command>' for details.\n")
+}
+
+func cmdHelp(args []string) int {
+	if len(args) == 0 {
+		usage()
+		return exitOK
+	}
+
+	c := getCommand(args[0])
+
+	if c == nil || c.run == nil {
+		fmt.Fprintf(os.Stderr, "mort: unknown command %q\n", args[0])
+		return exitUsage
+	}
+
+	fs := c.flagSet()
+	c.run(c, fs)
+	c.usage(fs)
+
+	return exitOK
+}
+
+// resolveTask finds a task by ID or, if the argument isn't a number, by a
+// unique case-insensitive title match.
+func resolveTask(db *store.Store, arg string) (*store.Task, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		task, err := db.GetTaskByID(id)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("no task with id %d", id)
+		}
+		return task, err
+	}
+
+	tasks, err := matchTasks(db, arg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(tasks) {
+	case 0:
+		return nil, fmt.Errorf("no task matching %q", arg)
+	case 1:
+		return db.GetTaskByID(tasks[0].ID)
+	}
+
+	for _, task := range tasks {
+		fmt.Fprintf(os.Stderr, "%6d %s\n", task.ID, task.Title)
+	}
+
+	return nil, fmt.Errorf("%d tasks match %q", len(tasks), arg)
+}
+
+// matchTasks returns the task with id arg, or the tasks with titles
+// containing arg.
+func matchTasks(db *store.Store, arg string) ([]store.Task, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		task, err := db.GetTaskByID(id)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
 		}
+		return []store.Task{*task}, nil
 	}
+
+	return db.GetTasks(store.TaskQuery{SearchTitle: arg})
+}
+
+// clockState describes what is currently clocked. Durations are in seconds.
+type clockState struct {
+	Active *store.Task `json:"active"`
+	Paused *store.Task `json:"paused"`
+
+	// Elapsed is the time since clock-in of the active task.
+	Elapsed int64 `json:"elapsed"`
+
+	// ProjectToday is the time clocked today on the project of the active
+	// or paused task.
+	ProjectToday int64 `json:"project_today"`
+
+	// Today is the total time clocked today.
+	Today int64 `json:"today"`
 }
 
-func cmdCheckinDurationActive(db *store.Store) {
+func getClockState(db *store.Store) (*clockState, error) {
+	var state clockState
+
 	activeID, err := db.GetActiveTaskID()
 
 	if err != nil {
-		log.Fatalf("Get active task id: %v", err)
+		return nil, fmt.Errorf("get active task id: %v", err)
 	}
 
 	if activeID > 0 {
-		task, err := db.GetTaskByID(activeID)
-		if err != nil {
-			log.Fatalf("Get active task: %v", err)
+		if state.Active, err = db.GetTaskByID(activeID); err != nil {
+			return nil, fmt.Errorf("get active task: %v", err)
 		}
-		if task.ClockinAt != nil {
-			delta := time.Now().Sub(*task.ClockinAt)
-			fmt.Printf("%s +%s\n", task.Project, formatDuration(delta))
+		if state.Active.ClockinAt != nil {
+			state.Elapsed = int64(time.Now().Sub(*state.Active.ClockinAt) / time.Second)
 		}
 	} else {
 		pausedID, err := db.GetPausedTaskID()
 		if err != nil {
-			log.Fatalf("Get paused task id: %v", err)
+			return nil, fmt.Errorf("get paused task id: %v", err)
 		}
 		if pausedID > 0 {
-			task, err := db.GetTaskByID(pausedID)
-			if err != nil {
-				log.Fatalf("Get paused task: %v", err)
+			if state.Paused, err = db.GetTaskByID(pausedID); err != nil {
+				return nil, fmt.Errorf("get paused task: %v", err)
 			}
-			r := store.TimeRange{}
-			r.Today()
-			entries, err := db.GetTimesheet(r)
-			var total time.Duration
-			for _, e := range entries {
-				if e.Project == task.Project && e.ClockoutAt != nil {
-					total += e.ClockoutAt.Sub(e.ClockinAt)
-				}
-			}
-			fmt.Printf("%s %s\n", task.Project, formatDuration(total))
 		}
 	}
-}
 
-func cmdCheckinDurationToday(db *store.Store) {
 	r := store.TimeRange{}
 	r.Today()
 	entries, err := db.GetTimesheet(r)
 
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
+	}
+
+	project := ""
+	if state.Active != nil {
+		project = state.Active.Project
+	} else if state.Paused != nil {
+		project = state.Paused.Project
 	}
 
-	var total time.Duration
-	active := ""
+	var total, projectTotal time.Duration
 	for _, e := range entries {
+		var delta time.Duration
 		if e.ClockoutAt != nil {
-			total += e.ClockoutAt.Sub(e.ClockinAt)
+			delta = e.ClockoutAt.Sub(e.ClockinAt)
 		} else {
-			total += time.Now().Sub(e.ClockinAt)
-			active = "+"
+			delta = time.Now().Sub(e.ClockinAt)
+		}
+		total += delta
+		if e.Project == project {
+			projectTotal += delta
 		}
 	}
-	fmt.Printf("today %s%s\n", active, formatDuration(total))
+
+	state.Today = int64(total / time.Second)
+	state.ProjectToday = int64(projectTotal / time.Second)
+
+	return &state, nil
 }
 
-func cmdRun(db *store.Store) {
-	logpath, err := xdg.Data.Ensure("mort/mort.log")
+func printClockState(db *store.Store, asJSON bool) error {
+	state, err := getClockState(db)
 
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 
-	f, err := os.OpenFile(logpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if asJSON {
+		return printJSON(state)
+	}
 
-	if err != nil {
-		log.Fatalln(err)
+	if state.Active != nil {
+		fmt.Printf("%s +%s\n", state.Active.Project, formatDuration(time.Duration(state.Elapsed)*time.Second))
+	} else if state.Paused != nil {
+		fmt.Printf("%s %s\n", state.Paused.Project, formatDuration(time.Duration(state.ProjectToday)*time.Second))
 	}
 
-	defer f.Close()
+	return nil
+}
+
+func cmdPauseActiveTask(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
 
-	log.SetOutput(f)
-	log.Printf("Starting %v", time.Now())
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		pausedID, err := db.GetPausedTaskID()
+
+		if err != nil {
+			return err
+		}
+
+		if pausedID > 0 {
+			if err := db.Clockin(pausedID); err != nil {
+				return err
+			}
+			return printClockState(db, *asJSON)
+		}
+
+		activeID, err := db.GetActiveTaskID()
+		if err != nil {
+			return err
+		}
 
-	xl.SetLogger(logger.Plain)
+		if activeID > 0 {
+			if _, err := db.Pause(); err != nil {
+				return err
+			}
+			return printClockState(db, *asJSON)
+		}
 
-	app := newMortApp(db)
+		if *asJSON {
+			return printClockState(db, true)
+		}
 
-	if err := app.Run(); err != nil {
-		log.Fatalln(err)
+		return nil
 	}
 }
 
-func cmdNewTask(db *store.Store, project, title *string) {
-	if project == nil || *project == "" {
-		log.Fatalf("Please provide -project")
+func cmdCheckinDurationActive(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		return printClockState(db, *asJSON)
 	}
+}
+
+func cmdCheckinDurationToday(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		state, err := getClockState(db)
+
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printJSON(state)
+		}
 
-	if title == nil || *title == "" {
-		log.Fatalf("Please provide -title")
+		active := ""
+		if state.Active != nil {
+			active = "+"
+		}
+		fmt.Printf("today %s%s\n", active, formatDuration(time.Duration(state.Today)*time.Second))
+
+		return nil
 	}
+}
+
+func cmdTimesheet(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+	week := fs.Bool("week", false, "Show the whole week")
+	offset := fs.Int("offset", 0, "Number of days or weeks back in time")
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		r := store.TimeRange{}
+		r.Today()
+		if *week {
+			r.Week()
+		}
+		for i := 0; i < *offset; i++ {
+			r.Prev()
+		}
+
+		entries, err := db.GetTimesheet(r)
+
+		if err != nil {
+			return err
+		}
 
-	var payload store.Task
-	payload.Project = *project
-	payload.Title = fmt.Sprintf("%s: %s", *project, *title)
-	payload.Body = fmt.Sprintf("%s: %s", *project, *title)
+		if *asJSON {
+			return printJSON(entries)
+		}
+
+		for _, line := range formatTimesheet(entries) {
+			fmt.Println(strings.TrimRight(line, "\n"))
+		}
+
+		return nil
+	}
+}
 
-	taskID, err := db.CreateTask(payload)
+// openStore opens the database of profile and updates the stored order of
+// todo states to follow the workflows of the active config.
+func openStore(profile string) (*store.Store, error) {
+	db, err := store.Open(profile)
 
 	if err != nil {
-		log.Fatalf("Failed to store task: %v", err)
-		return
+		return nil, err
+	}
+
+	if err := db.RenumberStates(conf.stateRanks); err != nil {
+		db.Close()
+		return nil, err
 	}
 
-	log.Printf("Created task %d", taskID)
+	return db, nil
 }
 
-func cmdListTasks(db *store.Store, project *string) {
-	var query store.TaskQuery
-	if project != nil {
-		query.Project = *project
+// logFile is the log of the current profile.
+var logFile *os.File
+
+// openLog directs the log to the log file next to the database.
+func openLog(db *store.Store) error {
+	logpath, err := db.DataPath("mort.log")
+
+	if err != nil {
+		return err
 	}
 
-	tasks, err := db.GetTasks(query)
+	f, err := os.OpenFile(logpath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+
 	if err != nil {
-		log.Fatalf("Failed to store task: %v", err)
-		return
+		return err
 	}
 
-	for _, task := range tasks {
-		fmt.Printf("%s\n", task.Title)
+	log.SetOutput(f)
+
+	if logFile != nil {
+		logFile.Close()
 	}
+
+	logFile = f
+
+	return nil
 }
 
-func cmdQueryTasks(db *store.Store, project *string) {
-	if project == nil || *project == "" {
-		log.Fatalf("Please provide -project")
+func cmdRun(c *command, fs *flag.FlagSet) commandFunc {
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		if err := openLog(db); err != nil {
+			return err
+		}
+
+		defer func() { logFile.Close() }()
+
+		log.Printf("Starting %v", time.Now())
+
+		xl.SetLogger(logger.Plain)
+
+		app := newMortApp(db)
+
+		return app.Run()
 	}
+}
 
-	var query store.TaskQuery
-	query.Project = *project
+func cmdNewTask(c *command, fs *flag.FlagSet) commandFunc {
+	project := fs.String("project", "", "Project for new task")
+	title := fs.String("title", "", "Title for new task")
+	file := fs.String("file", "", "Read task body from file, or from stdin if -")
+	parent := fs.String("parent", "", "Parent task (id or search)")
+	state := fs.String("state", "", "Todo state in the project's workflow")
+	schedule := fs.String("schedule", "", "Schedule task, e.g. 2006-01-02, \"2006-01-02 15:04\", today or tomorrow")
+	estimate := fs.String("estimate", "", "Time estimate, e.g. 1h30m or 01:30")
+	asJSON := jsonFlag(fs)
 
-	tasks, err := db.GetTasks(query)
-	if err != nil {
-		log.Fatalf("Failed to store task: %v", err)
-		return
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		var body string
+
+		if *file == "-" || (*file == "" && *title == "" && !isTerminal(os.Stdin)) {
+			buf, err := ioutil.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			body = string(buf)
+		} else if *file != "" {
+			buf, err := ioutil.ReadFile(*file)
+			if err != nil {
+				return err
+			}
+			body = string(buf)
+		}
+
+		body = strings.TrimLeft(body, "\n")
+
+		if *title != "" {
+			if *project == "" {
+				return usagef("please provide -project")
+			}
+			heading := fmt.Sprintf("%s: %s", *project, *title)
+			if body != "" {
+				body = heading + "\n\n" + body
+			} else {
+				body = heading
+			}
+		} else if body == "" {
+			return usagef("please provide -title, -file or a body on stdin")
+		} else if *project != "" && store.GetProjectFromTitle(store.GetTitleFromBody(body)) != *project {
+			body = *project + ": " + body
+		}
+
+		var payload store.Task
+		payload.Title = store.GetTitleFromBody(body)
+		payload.Project = store.GetProjectFromTitle(payload.Title)
+		payload.Body = body
+
+		if *parent != "" {
+			task, err := resolveTask(db, *parent)
+			if err != nil {
+				return fmt.Errorf("parent: %v", err)
+			}
+			payload.ParentID = &task.ID
+		}
+
+		if *state != "" {
+			w := getWorkflow(payload.Project)
+			name := strings.ToUpper(*state)
+			if w.stateIndex(name) < 0 {
+				return usagef("unknown state %q, expected one of %s", *state, strings.Join(w.stateNames(), ", "))
+			}
+			idx := stateRank(name) * store.StateStride
+			payload.State = &name
+			payload.StateIdx = &idx
+		}
+
+		if *schedule != "" {
+			t, err := parseSchedule(*schedule)
+			if err != nil {
+				return usagef("invalid schedule: %v", err)
+			}
+			payload.ScheduledAt = &t
+		}
+
+		if *estimate != "" {
+			d, err := parseDuration(*estimate)
+			if err != nil {
+				return usagef("invalid estimate: %v", err)
+			}
+			seconds := int64(d / time.Second)
+			payload.Estimate = &seconds
+		}
+
+		taskID, err := db.CreateTask(payload)
+
+		if err != nil {
+			return fmt.Errorf("failed to store task: %v", err)
+		}
+
+		if *asJSON {
+			return printTaskJSON(db, taskID)
+		}
+
+		fmt.Println(taskID)
+
+		return nil
+	}
+}
+
+// parseSchedule parses a date with optional time of day in local time.
+func parseSchedule(s string) (time.Time, error) {
+	today := beginningOfDay(time.Now())
+
+	switch strings.ToLower(s) {
+	case "today":
+		return today, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
 	}
 
-	if len(tasks) == 0 {
-		os.Exit(1)
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
 	}
+
+	return time.Time{}, fmt.Errorf("unknown date format %q", s)
 }
 
-func main() {
-	newtask := flag.Bool("new", false, "Create new task")
-	project := flag.String("project", "", "Project for new note")
-	title := flag.String("title", "", "Title for new note")
+func beginningOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
 
-	list := flag.Bool("list", false, "List tasks")
-	query := flag.Bool("query", false, "Query tasks. Analogous to grep --quiet.")
-	pause := flag.Bool("pause", false, "Pause current task (or clockin again)")
-	clock := flag.Bool("clock", false, "Return current checkin duration")
-	today := flag.Bool("today", false, "Return total checkin duration today")
-	flag.Parse()
+func cmdShowTask(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
 
-	db, err := store.Default()
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 1, -1)
 
-	if err != nil {
-		log.Fatalln(err)
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, strings.Join(args, " "))
+
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printJSON(task)
+		}
+
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{"ID", fmt.Sprintf("%d", task.ID)},
+			{"Project", task.Project},
+			{"Created", formatTimestamp(&task.CreatedAt)},
+			{"Updated", formatTimestamp(&task.UpdatedAt)},
+			{"Scheduled", formatTimestamp(task.ScheduledAt)},
+			{"Clocked in", formatTimestamp(task.ClockinAt)},
+			{"Paused", formatTimestamp(task.PausedAt)},
+			{"Archived", formatTimestamp(task.ArchivedAt)},
+			{"Spent", formatDuration(time.Duration(task.Spent) * time.Second)},
+		}
+
+		if task.State != nil {
+			fields = append(fields, struct{ name, value string }{"State", *task.State})
+		}
+
+		if task.ParentID != nil {
+			fields = append(fields, struct{ name, value string }{"Parent", fmt.Sprintf("%d", *task.ParentID)})
+		}
+
+		if task.Estimate != nil {
+			fields = append(fields, struct{ name, value string }{"Estimate", formatDuration(time.Duration(*task.Estimate) * time.Second)})
+		}
+
+		for _, f := range fields {
+			if f.value != "" {
+				fmt.Printf("%-11s %s\n", f.name+":", f.value)
+			}
+		}
+
+		fmt.Printf("\n%s", task.Body)
+
+		if !strings.HasSuffix(task.Body, "\n") {
+			fmt.Println()
+		}
+
+		return nil
 	}
+}
 
-	switch {
+func formatTimestamp(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format(conf.Formats.Timestamp)
+}
+
+func cmdInit(c *command, fs *flag.FlagSet) commandFunc {
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 1)
+
+		if err != nil {
+			return err
+		}
+
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		local, err := store.InitLocal(dir)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Initialized task database in %s\n", local)
+
+		return nil
+	}
+}
+
+func cmdProfiles(c *command, fs *flag.FlagSet) commandFunc {
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		profiles, err := store.Profiles()
+
+		if err != nil {
+			return err
+		}
+
+		for _, profile := range profiles {
+			marker := " "
+			if profile == db.Profile() {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, profile)
+		}
+
+		return nil
+	}
+}
+
+func cmdEditTask(c *command, fs *flag.FlagSet) commandFunc {
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 1, -1)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, strings.Join(args, " "))
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.SetDraft(task.ID, task.Body); err != nil {
+			return err
+		}
+
+		body, err := db.GetDraft(task.ID, false)
+
+		if err != nil {
+			return fmt.Errorf("failed to get draft: %v", err)
+		}
+
+		if body == "" {
+			return errors.New("empty body")
+		}
+
+		if body == task.Body {
+			fmt.Fprintln(os.Stderr, "No change.")
+			return nil
+		}
+
+		var payload store.Task
+		payload.Title = store.GetTitleFromBody(body)
+		payload.Project = store.GetProjectFromTitle(payload.Title)
+		payload.Body = body
+
+		if err := db.UpdateTaskByID(task.ID, payload); err != nil {
+			return fmt.Errorf("failed to update task: %v", err)
+		}
+
+		return nil
+	}
+}
+
+func cmdClockin(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 1, -1)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, strings.Join(args, " "))
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.Clockin(task.ID); err != nil {
+			return fmt.Errorf("failed to clock in: %v", err)
+		}
+
+		return printClockState(db, *asJSON)
+	}
+}
+
+func cmdClockout(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		taskID, err := db.GetActiveTaskID()
+
+		if err != nil {
+			return err
+		}
+
+		if taskID == 0 {
+			return errors.New("not clocked in")
+		}
+
+		if err := db.Clockout(); err != nil {
+			return fmt.Errorf("failed to clock out: %v", err)
+		}
+
+		if *asJSON {
+			return printClockState(db, true)
+		}
+
+		return nil
+	}
+}
+
+func cmdSetState(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 2, 2)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, args[0])
+
+		if err != nil {
+			return err
+		}
+
+		w := getWorkflow(task.Project)
+		state := strings.ToUpper(args[1])
+		idx := -1
+
+		if state == "NONE" {
+			state = ""
+		} else if w.stateIndex(state) < 0 {
+			return usagef("unknown state %q, expected one of %s or none", args[1], strings.Join(w.stateNames(), ", "))
+		} else {
+			idx = stateRank(state)
+		}
+
+		if err := db.SetTodoState(task.ID, idx, state); err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printTaskJSON(db, task.ID)
+		}
+
+		return nil
+	}
+}
+
+func cmdArchive(c *command, fs *flag.FlagSet) commandFunc {
+	return setArchived(c, fs, true)
+}
+
+func cmdUnarchive(c *command, fs *flag.FlagSet) commandFunc {
+	return setArchived(c, fs, false)
+}
+
+func setArchived(c *command, fs *flag.FlagSet, archived bool) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 1, -1)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, strings.Join(args, " "))
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.SetArchived(task.ID, archived); err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printTaskJSON(db, task.ID)
+		}
+
+		return nil
+	}
+}
+
+func cmdSetEstimate(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 2, 2)
+
+		if err != nil {
+			return err
+		}
+
+		d, err := parseDuration(args[1])
+
+		if err != nil {
+			return usagef("invalid estimate: %v", err)
+		}
+
+		task, err := resolveTask(db, args[0])
+
+		if err != nil {
+			return err
+		}
+
+		if err := db.SetEstimate(task.ID, d); err != nil {
+			return fmt.Errorf("failed to set estimate: %v", err)
+		}
+
+		if *asJSON {
+			return printTaskJSON(db, task.ID)
+		}
+
+		return nil
+	}
+}
+
+func cmdSetParent(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 2, 2)
+
+		if err != nil {
+			return err
+		}
+
+		task, err := resolveTask(db, args[0])
+
+		if err != nil {
+			return err
+		}
+
+		var parentID int64
+
+		if strings.ToLower(args[1]) != "none" {
+			parent, err := resolveTask(db, args[1])
+
+			if err != nil {
+				return fmt.Errorf("parent: %v", err)
+			}
+
+			parentID = parent.ID
+		}
+
+		if err := db.SetParent(task.ID, parentID); err != nil {
+			return fmt.Errorf("failed to set parent: %v", err)
+		}
+
+		if *asJSON {
+			return printTaskJSON(db, task.ID)
+		}
+
+		return nil
+	}
+}
+
+func cmdEstimateReport(c *command, fs *flag.FlagSet) commandFunc {
+	project := fs.String("project", "", "Only report tasks in project")
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		var query store.TaskQuery
+		query.Archived = true
+		query.Estimated = true
+		query.Spent = true
+		query.Project = *project
+
+		tasks, err := db.GetTasks(query)
+		if err != nil {
+			return fmt.Errorf("failed to get tasks: %v", err)
+		}
+
+		if *asJSON {
+			return printJSON(tasks)
+		}
+
+		color := ""
+		reset := ""
+		if isTerminal(os.Stdout) {
+			color = "\033[31m"
+			reset = "\033[0m"
+		}
+
+		var totalSpent, totalEstimate time.Duration
+
+		for _, task := range tasks {
+			spent := time.Duration(task.Spent) * time.Second
+			estimate := time.Duration(*task.Estimate) * time.Second
+			totalSpent += spent
+			totalEstimate += estimate
+
+			line := formatEstimateLine(fmt.Sprintf("%d", task.ID), estimate, spent, task.Title)
+			if spent > estimate {
+				line = color + line + reset
+			}
+			fmt.Println(line)
+		}
+
+		if len(tasks) > 0 {
+			fmt.Println(formatEstimateLine("total", totalEstimate, totalSpent, ""))
+		}
+
+		return nil
+	}
+}
+
+func cmdProjects(c *command, fs *flag.FlagSet) commandFunc {
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		var week, month store.TimeRange
+		week.Today()
+		week.Week()
+		month.Today()
+		month.Month()
+
+		projects, err := db.GetProjects(week, month)
+		if err != nil {
+			return fmt.Errorf("failed to get projects: %v", err)
+		}
+
+		if *asJSON {
+			return printJSON(projects)
+		}
+
+		for _, line := range formatProjects(projects) {
+			fmt.Println(line)
+		}
+
+		return nil
+	}
+}
+
+func cmdViews(c *command, fs *flag.FlagSet) commandFunc {
+	save := fs.String("save", "", "Save query as a view with this name")
+	search := fs.String("search", "", "Fuzzy search pattern of the saved view")
+	del := fs.String("delete", "", "Delete the view with this name")
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, -1)
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case *save != "" && *del != "":
+			return usagef("-save can't be combined with -delete")
+		case *save != "":
+			query, err := store.ParseQueryArgs(args)
+			if err != nil {
+				return usagef("invalid query: %v", err)
+			}
+			return db.SaveView(store.View{Name: *save, Query: formatViewQuery(query), Search: *search})
+		case len(args) > 0 || *search != "":
+			return usagef("a query requires -save")
+		case *del != "":
+			return db.DeleteView(*del)
+		}
+
+		views, err := db.GetViews()
+		if err != nil {
+			return fmt.Errorf("failed to get views: %v", err)
+		}
+
+		if *asJSON {
+			return printJSON(views)
+		}
+
+		for _, line := range formatViews(views) {
+			fmt.Println(line)
+		}
+
+		return nil
+	}
+}
+
+func formatEstimateLine(id string, estimate, spent time.Duration, title string) string {
+	mark := " "
+	diff := "+" + formatDuration(estimate-spent)
+	if spent > estimate {
+		mark = "!"
+		diff = "-" + formatDuration(spent-estimate)
+	}
+	return fmt.Sprintf("%s %6s %s %s %s %s", mark, id, formatDuration(estimate), formatDuration(spent), diff, title)
+}
+
+func jsonFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("json", false, "Print output as JSON")
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printTaskJSON(db *store.Store, id int64) error {
+	task, err := db.GetTaskByID(id)
+
+	if err != nil {
+		return err
+	}
+
+	return printJSON(task)
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// legacyArgs translates the flag-style invocation of older mort versions,
+// e.g. "mort -new -project x -title y", to a subcommand invocation.
+func legacyArgs(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("mort", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	newtask := fs.Bool("new", false, "Create new task")
+	project := fs.String("project", "", "Project for new note")
+	title := fs.String("title", "", "Title for new note")
+	id := fs.Int64("id", 0, "Task to operate on")
+	estimate := fs.String("estimate", "", "Time estimate for new task or task given by -id")
+	estimates := fs.Bool("estimates", false, "Report estimated vs clocked time")
+
+	list := fs.Bool("list", false, "List tasks")
+	query := fs.Bool("query", false, "Query tasks. Analogous to grep --quiet.")
+	pause := fs.Bool("pause", false, "Pause current task (or clockin again)")
+	clock := fs.Bool("clock", false, "Return current checkin duration")
+	today := fs.Bool("today", false, "Return total checkin duration today")
+	asJSON := jsonFlag(fs)
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() > 0 {
+		return nil, usagef("unexpected argument %q", fs.Arg(0))
+	}
+
+	var projectArgs []string
+	if *project != "" {
+		projectArgs = []string{"-project", *project}
+	}
+
+	var jsonArgs []string
+	if *asJSON {
+		jsonArgs = []string{"-json"}
+	}
+
+	switch {
 	case *pause:
-		cmdPauseActiveTask(db)
+		return []string{"pause"}, nil
 	case *clock:
-		cmdCheckinDurationActive(db)
+		return append([]string{"clock"}, jsonArgs...), nil
 	case *today:
-		cmdCheckinDurationToday(db)
+		return append([]string{"today"}, jsonArgs...), nil
 	case *newtask:
-		cmdNewTask(db, project, title)
+		// Unlike "mort new", the legacy flag never read the title from stdin.
+		if *title == "" {
+			return nil, usagef("please provide -title")
+		}
+		newArgs := []string{"new", "-project", *project, "-title", *title, "-estimate", *estimate}
+		return append(newArgs, jsonArgs...), nil
+	case *estimates:
+		return append([]string{"estimates"}, projectArgs...), nil
+	case *estimate != "":
+		return []string{"estimate", fmt.Sprintf("%d", *id), *estimate}, nil
 	case *list:
-		cmdListTasks(db, project)
+		return append(append([]string{"list"}, jsonArgs...), projectArgs...), nil
 	case *query:
-		cmdQueryTasks(db, project)
-	default:
-		cmdRun(db)
+		return append([]string{"query"}, projectArgs...), nil
+	}
+
+	return []string{"tui"}, nil
+}
+
+// parseProfile removes a leading --profile option from args. The profile
+// defaults to $MORT_PROFILE.
+func parseProfile(args []string) (string, []string, error) {
+	profile := os.Getenv("MORT_PROFILE")
+
+	if len(args) > 0 {
+		arg := args[0]
+
+		switch {
+		case arg == "-profile" || arg == "--profile":
+			if len(args) < 2 {
+				return "", nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			profile = args[1]
+			args = args[2:]
+		case strings.HasPrefix(arg, "-profile=") || strings.HasPrefix(arg, "--profile="):
+			profile = arg[strings.Index(arg, "=")+1:]
+			args = args[1:]
+		}
+	}
+
+	if profile == "" {
+		profile = store.DefaultProfile
+	}
+
+	return profile, args, store.CheckProfileName(profile)
+}
+
+func run(args []string) int {
+	profile, args, err := parseProfile(args)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mort: %v\n", err)
+		return exitUsage
+	}
+
+	if len(args) == 0 {
+		args = []string{"tui"}
+	} else if strings.HasPrefix(args[0], "-") {
+		if args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+			usage()
+			return exitOK
+		}
+
+		if args, err = legacyArgs(args); err != nil {
+			fmt.Fprintf(os.Stderr, "mort: %v\n", err)
+			usage()
+			return exitUsage
+		}
+	}
+
+	if args[0] == "help" {
+		return cmdHelp(args[1:])
+	}
+
+	c := getCommand(args[0])
+
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "mort: unknown command %q\n", args[0])
+		usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig(configPath())
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mort: config: %v\n", err)
+		return exitError
 	}
+
+	cfg.apply()
+
+	for _, warning := range cfg.warnings {
+		fmt.Fprintf(os.Stderr, "mort: config: warning: %s\n", warning)
+	}
+
+	var db *store.Store
+
+	// init creates the database itself.
+	if c.name != "init" {
+		db, err = openStore(profile)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "mort: %v\n", err)
+			return exitError
+		}
+	}
+
+	err = c.run(c, c.flagSet())(db, args[1:])
+
+	switch e := err.(type) {
+	case nil:
+		return exitOK
+	case exitStatus:
+		return int(e)
+	case usageError:
+		fmt.Fprintf(os.Stderr, "mort %s: %v\nRun 'mort help %s' for usage.\n", c.name, e, c.name)
+		return exitUsage
+	}
+
+	if err == flag.ErrHelp {
+		return exitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "mort %s: %v\n", c.name, err)
+
+	return exitError
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
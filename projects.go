@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xui"
+)
+
+// projectsWidget lists projects with task counts and clocked time. The first
+// line is a header.
+type projectsWidget struct {
+	base     xui.ListWidget
+	projects []store.Project
+}
+
+func (w *projectsWidget) View() *gocui.View {
+	return w.base.View()
+}
+
+func (w *projectsWidget) SetView(view *gocui.View) {
+	w.base.Highlight = true
+	w.base.SetView(view)
+	conf.theme.setSelectionStyle(view)
+}
+
+// SetModel replaces the projects, keeping the selected project if it still
+// exists.
+func (w *projectsWidget) SetModel(projects []store.Project) {
+	name := ""
+	if p := w.CurrentProject(); p != nil {
+		name = p.Name
+	}
+
+	w.projects = projects
+	w.base.SetModel(formatProjects(projects))
+
+	current := 0
+	for i := range projects {
+		if projects[i].Name == name {
+			current = i
+		}
+	}
+
+	w.base.SetCurrent(current + 1)
+}
+
+// CurrentProject returns the selected project or nil if the header is
+// selected.
+func (w *projectsWidget) CurrentProject() *store.Project {
+	idx := w.base.Current() - 1
+	if idx >= 0 && idx < len(w.projects) {
+		return &w.projects[idx]
+	}
+	return nil
+}
+
+func (w *projectsWidget) HandleAction(action string) error {
+	return w.base.HandleAction(action)
+}
+
+// noProject is shown instead of the empty name of tasks without project.
+const noProject = "(none)"
+
+// formatProjects formats projects as a table with a header.
+func formatProjects(projects []store.Project) []string {
+	row := "%-20s %5s %5s %5s %8s %6s %6s  %s"
+	lines := []string{fmt.Sprintf(row, "PROJECT", "OPEN", "TODO", "DONE", "ARCHIVED", "WEEK", "MONTH", "LAST ACTIVITY")}
+	now := time.Now()
+
+	count := func(n int64) string {
+		return fmt.Sprintf("%d", n)
+	}
+
+	hours := func(seconds int64) string {
+		if seconds == 0 {
+			return "-"
+		}
+		return formatDuration(time.Duration(seconds) * time.Second)
+	}
+
+	for _, p := range projects {
+		name := p.Name
+		if name == "" {
+			name = noProject
+		}
+		lines = append(lines, fmt.Sprintf(row, name, count(p.Open), count(p.Todo), count(p.Done), count(p.Archived), hours(p.Week), hours(p.Month), formatAge(p.LastActivity, now)))
+	}
+
+	return lines
+}
+
+func (app *mortApp) showProjectsView() {
+	app.gx.Focus(app.projects.View())
+	app.loadProjects()
+}
+
+// loadProjects summarizes the projects with the time clocked this week and
+// this month.
+func (app *mortApp) loadProjects() {
+	var week, month store.TimeRange
+	week.Today()
+	week.Week()
+	month.Today()
+	month.Month()
+
+	projects, err := app.db.GetProjects(week, month)
+
+	if err != nil {
+		app.setMessage("Failed to load projects: %v", err)
+		return
+	}
+
+	app.projects.SetModel(projects)
+	app.setStatus(fmt.Sprintf("%d projects | week %s | month %s", len(projects), week.String(), month.String()))
+}
+
+// openProject shows the tasks of the selected project. Other filters except
+// todo mode are reset.
+func (app *mortApp) openProject() {
+	p := app.projects.CurrentProject()
+
+	if p == nil {
+		app.setMessage("No project.")
+		return
+	}
+
+	// An empty project filter would show all tasks.
+	if p.Name == "" {
+		app.setMessage("Tasks without project can't be opened.")
+		return
+	}
+
+	app.Filter = store.TaskQuery{Todo: app.Filter.Todo, Project: p.Name}
+	app.showTasksView()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/tomyl/mort/store"
+)
+
+// statusPresets are ready-made templates for mort status.
+var statusPresets = map[string]string{
+	"default": `{{with .Active}}{{.Project}} +{{duration $.Elapsed}}{{else}}{{with .Paused}}{{.Project}} {{duration $.ProjectToday}}{{end}}{{end}}`,
+
+	// i3blocks reads full text, short text and color from separate lines.
+	"i3blocks": `{{with .Active}}{{.Project}} +{{duration $.Elapsed}}
+{{.Project}}
+#00FF00{{else}}{{with .Paused}}{{.Project}} {{duration $.ProjectToday}}
+{{.Project}}
+#FFFF00{{else}}today {{duration .Today}}
+{{duration .Today}}
+#888888{{end}}{{end}}`,
+
+	"waybar": `{"text": {{json .Text}}, "tooltip": {{json .Tooltip}}, "class": {{json .Class}}, "alt": {{json .Class}}}`,
+
+	"tmux": `{{with .Active}}#[fg=green]{{.Project}} +{{duration $.Elapsed}}#[default]{{else}}{{with .Paused}}#[fg=yellow]{{.Project}} {{duration $.ProjectToday}}#[default]{{end}}{{end}}`,
+}
+
+// statusData is the data passed to status templates.
+type statusData struct {
+	clockState
+
+	// Class is active, paused or idle.
+	Class string
+
+	// Text is the output of the default preset.
+	Text string
+
+	// Tooltip is a longer description of the clock state.
+	Tooltip string
+}
+
+var statusFuncs = template.FuncMap{
+	"duration": func(seconds int64) string {
+		return formatDuration(time.Duration(seconds) * time.Second)
+	},
+	"json": func(v interface{}) (string, error) {
+		buf, err := json.Marshal(v)
+		return string(buf), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+func parseStatusTemplate(text string) (*template.Template, error) {
+	return template.New("status").Funcs(statusFuncs).Parse(text)
+}
+
+func newStatusData(state *clockState) (*statusData, error) {
+	data := statusData{clockState: *state}
+
+	tmpl, err := parseStatusTemplate(statusPresets["default"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	var text strings.Builder
+
+	if err := tmpl.Execute(&text, state); err != nil {
+		return nil, err
+	}
+
+	data.Text = text.String()
+	today := formatDuration(time.Duration(state.Today) * time.Second)
+
+	switch {
+	case state.Active != nil:
+		data.Class = "active"
+		data.Tooltip = fmt.Sprintf("%s\nToday %s", state.Active.Title, today)
+	case state.Paused != nil:
+		data.Class = "paused"
+		data.Tooltip = fmt.Sprintf("%s (paused)\nToday %s", state.Paused.Title, today)
+	default:
+		data.Class = "idle"
+		data.Tooltip = fmt.Sprintf("Today %s", today)
+	}
+
+	return &data, nil
+}
+
+func cmdStatus(c *command, fs *flag.FlagSet) commandFunc {
+	names := make([]string, 0, len(statusPresets))
+	for name := range statusPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	format := fs.String("format", "", "Go text/template, e.g. '{{with .Active}}{{.Title}}{{end}}'")
+	preset := fs.String("preset", "default", "Ready-made format ("+strings.Join(names, ", ")+")")
+	asJSON := jsonFlag(fs)
+
+	return func(db *store.Store, args []string) error {
+		args, err := c.parse(fs, args, 0, 0)
+
+		if err != nil {
+			return err
+		}
+
+		text := *format
+
+		if text == "" {
+			var ok bool
+			if text, ok = statusPresets[*preset]; !ok {
+				return usagef("unknown preset %q", *preset)
+			}
+		}
+
+		tmpl, err := parseStatusTemplate(text)
+
+		if err != nil {
+			return usagef("invalid format: %v", err)
+		}
+
+		state, err := getClockState(db)
+
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			return printJSON(state)
+		}
+
+		data, err := newStatusData(state)
+
+		if err != nil {
+			return err
+		}
+
+		var out strings.Builder
+
+		if err := tmpl.Execute(&out, data); err != nil {
+			return err
+		}
+
+		if out.Len() > 0 {
+			fmt.Fprintln(os.Stdout, strings.TrimRight(out.String(), "\n"))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// The bulk operations below change several tasks in one transaction. Either
+// all tasks are changed or none.
+
+func (s *Store) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SetArchivedTasks archives or unarchives tasks.
+func (s *Store) SetArchivedTasks(ids []int64, archived bool) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			var err error
+			if archived {
+				_, err = tx.Exec("UPDATE task SET archived_at=current_timestamp WHERE id=?", id)
+			} else {
+				_, err = tx.Exec("UPDATE task SET archived_at=NULL WHERE id=?", id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetTodoStates sets the todo state of tasks, see SetTodoState. idxs holds
+// the sort position of state for each task.
+func (s *Store) SetTodoStates(ids []int64, idxs []int, state string) error {
+	if len(ids) != len(idxs) {
+		return fmt.Errorf("got %d tasks but %d state positions", len(ids), len(idxs))
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		for i, id := range ids {
+			var err error
+			if idxs[i] < 0 || state == "" {
+				_, err = tx.Exec("UPDATE task SET state_idx=NULL, state=NULL WHERE id=?", id)
+			} else {
+				_, err = tx.Exec("UPDATE task SET state_idx=?, state=? WHERE id=?", idxs[i]*StateStride, state, id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetProjects moves tasks to another project by replacing the project prefix
+// of their titles, see SetProjectInBody.
+func (s *Store) SetProjects(ids []int64, project string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			var body sql.NullString
+
+			if err := tx.QueryRow("SELECT body FROM task WHERE id=?", id).Scan(&body); err != nil {
+				return fmt.Errorf("task %d: %v", id, err)
+			}
+
+			newBody := SetProjectInBody(body.String, project)
+			title := GetTitleFromBody(newBody)
+
+			if _, err := tx.Exec("UPDATE task SET project=?, title=?, body=?, updated_at=current_timestamp WHERE id=?", GetProjectFromTitle(title), title, newBody, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteTasks deletes tasks and their timesheet entries. Children of deleted
+// tasks are moved to the parent of the deleted task.
+func (s *Store) DeleteTasks(ids []int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("UPDATE task SET parent_id=(SELECT parent_id FROM task WHERE id=?) WHERE parent_id=?", id, id); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("DELETE FROM timesheet WHERE task_id=?", id); err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec("DELETE FROM task WHERE id=?", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SetProjectInBody replaces the project prefix of the title line of body.
+// An empty project or the default project removes the prefix.
+func SetProjectInBody(body, project string) string {
+	title := GetTitleFromBody(body)
+	rest := body[len(title):]
+
+	if idx := strings.Index(title, ":"); idx >= 0 {
+		title = strings.TrimLeft(title[idx+1:], " ")
+	}
+
+	if project != "" && project != "default" {
+		title = project + ": " + title
+	}
+
+	return title + rest
+}
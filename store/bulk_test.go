@@ -0,0 +1,88 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xl"
+	"github.com/tomyl/xl/testlogger"
+)
+
+func TestBulk(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	ids := make([]int64, 0)
+
+	for _, body := range []string{"acme: one\n\nBody.", "two", "web: three"} {
+		id, err := db.CreateTask(store.Task{Title: store.GetTitleFromBody(body), Project: store.GetProjectFromTitle(body), Body: body})
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+
+	childID, err := db.CreateTask(store.Task{Title: "child", Body: "child", ParentID: &ids[0]})
+	require.Nil(t, err)
+
+	require.Nil(t, db.SetProjects(ids[:2], "ops"))
+
+	{
+		task, err := db.GetTaskByID(ids[0])
+		require.Nil(t, err)
+		require.Equal(t, "ops", task.Project)
+		require.Equal(t, "ops: one", task.Title)
+		require.Equal(t, "ops: one\n\nBody.", task.Body)
+
+		task, err = db.GetTaskByID(ids[1])
+		require.Nil(t, err)
+		require.Equal(t, "ops: two", task.Title)
+	}
+
+	require.Nil(t, db.SetTodoStates(ids, []int{0, 1, -1}, "WAIT"))
+	require.NotNil(t, db.SetTodoStates(ids, []int{0}, "WAIT"))
+
+	{
+		tasks, err := db.GetTasks(store.TaskQuery{States: []string{"WAIT"}})
+		require.Nil(t, err)
+		require.Equal(t, 2, len(tasks))
+	}
+
+	require.Nil(t, db.SetArchivedTasks(ids[1:], true))
+
+	{
+		tasks, err := db.GetTasks(store.TaskQuery{})
+		require.Nil(t, err)
+		require.Equal(t, 2, len(tasks))
+	}
+
+	require.Nil(t, db.Clockin(ids[0]))
+	require.Nil(t, db.Clockout())
+	require.Nil(t, db.DeleteTasks(ids[:1]))
+
+	{
+		tasks, err := db.GetTasks(store.TaskQuery{Archived: true})
+		require.Nil(t, err)
+		require.Equal(t, 3, len(tasks))
+
+		task, err := db.GetTaskByID(childID)
+		require.Nil(t, err)
+		require.Nil(t, task.ParentID)
+
+		entries, err := db.GetTimesheet(store.TimeRange{End: time.Now().UTC().Add(time.Hour)})
+		require.Nil(t, err)
+		require.Equal(t, 0, len(entries))
+	}
+}
+
+func TestSetProjectInBody(t *testing.T) {
+	require.Equal(t, "web: fix", store.SetProjectInBody("acme:  fix", "web"))
+	require.Equal(t, "web: fix\nmore", store.SetProjectInBody("fix\nmore", "web"))
+	require.Equal(t, "fix\n", store.SetProjectInBody("acme: fix\n", ""))
+}
@@ -6,30 +6,45 @@ import (
 	"os"
 	"os/exec"
 	"strings"
-
-	xdg "github.com/queria/golang-go-xdg"
 )
 
-// SetDraft saves task body to a file.
-func SetDraft(id int64, body string) error {
-	filepath, err := getDraftPath(id)
+// SetDraft saves task body to a file in the drafts directory of the store.
+func (s *Store) SetDraft(id int64, body string) error {
+	filepath, err := s.getDraftPath(id)
 	if err != nil {
 		return err
 	}
 	return ioutil.WriteFile(filepath, []byte(body), os.ModePerm)
 }
 
-func getDraftPath(id int64) (string, error) {
+func (s *Store) getDraftPath(id int64) (string, error) {
 	name := "new"
 	if id > 0 {
 		name = fmt.Sprintf("%d", id)
 	}
-	return xdg.Data.Ensure("mort/draft/" + name)
+	return s.DataPath("draft/" + name)
+}
+
+// ReadDraft returns the saved draft of provided task id, or an empty string
+// if there is none.
+func (s *Store) ReadDraft(id int64) (string, error) {
+	filepath, err := s.getDraftPath(id)
+	if err != nil {
+		return "", err
+	}
+
+	buf, err := ioutil.ReadFile(filepath)
+
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+
+	return string(buf), err
 }
 
 // GetDraft opens an editor for provided task id. Call SetDraft() first.
-func GetDraft(id int64, insert bool) (string, error) {
-	filepath, err := getDraftPath(id)
+func (s *Store) GetDraft(id int64, insert bool) (string, error) {
+	filepath, err := s.getDraftPath(id)
 	if err != nil {
 		return "", err
 	}
@@ -47,21 +62,18 @@ func GetDraft(id int64, insert bool) (string, error) {
 		return "", err
 	}
 
-	buf, err := ioutil.ReadFile(filepath)
-
-	if err != nil {
-		return "", err
-	}
-
-	return string(buf), nil
+	return s.ReadDraft(id)
 }
 
+// FallbackEditor is the editor used when $EDITOR isn't set.
+var FallbackEditor = "vim"
+
 func getEditor() string {
 	editor := os.Getenv("EDITOR")
 	if editor != "" {
 		return editor
 	}
-	return "vim"
+	return FallbackEditor
 }
 
 // GetProjectFromTitle extracts the project name from the task title.
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Scores of FuzzyMatch.
+const (
+	fuzzyRuneScore        = 16
+	fuzzyConsecutiveBonus = 12
+	fuzzyWordStartBonus   = 8
+	fuzzyGapPenalty       = 2
+)
+
+// FuzzyMatch reports whether the runes of pattern occur in s in order, not
+// necessarily next to each other. Spaces in pattern are ignored. Matching is
+// case-insensitive unless pattern contains upper case letters.
+//
+// The score is higher for consecutive runes and runes at the start of words,
+// and lower for gaps between runes. positions holds the rune indices of the
+// matched runes in s.
+func FuzzyMatch(pattern, s string) (score int, positions []int, ok bool) {
+	p := []rune(strings.Replace(pattern, " ", "", -1))
+
+	if len(p) == 0 {
+		return 0, nil, true
+	}
+
+	fold := true
+
+	for _, ch := range p {
+		if unicode.IsUpper(ch) {
+			fold = false
+			break
+		}
+	}
+
+	r := []rune(s)
+
+	eq := func(a, b rune) bool {
+		if fold {
+			return unicode.ToLower(a) == unicode.ToLower(b)
+		}
+		return a == b
+	}
+
+	// Find the first match, then search backwards from its end for the
+	// shortest match ending there.
+	end := -1
+
+	for i, k := 0, 0; i < len(r); i++ {
+		if eq(r[i], p[k]) {
+			if k++; k == len(p) {
+				end = i
+				break
+			}
+		}
+	}
+
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	start := end
+
+	for i, k := end, len(p)-1; i >= 0; i-- {
+		if eq(r[i], p[k]) {
+			if k--; k < 0 {
+				start = i
+				break
+			}
+		}
+	}
+
+	positions = make([]int, 0, len(p))
+
+	for i, k := start, 0; i <= end && k < len(p); i++ {
+		if eq(r[i], p[k]) {
+			positions = append(positions, i)
+			k++
+		}
+	}
+
+	for k, pos := range positions {
+		score += fuzzyRuneScore
+
+		if pos == 0 || isWordSeparator(r[pos-1]) {
+			score += fuzzyWordStartBonus
+		}
+
+		if k > 0 {
+			if gap := pos - positions[k-1] - 1; gap == 0 {
+				score += fuzzyConsecutiveBonus
+			} else {
+				score -= fuzzyGapPenalty + gap
+			}
+		}
+	}
+
+	return score, positions, true
+}
+
+func isWordSeparator(ch rune) bool {
+	return unicode.IsSpace(ch) || strings.ContainsRune(":-_/.,#()[]", ch)
+}
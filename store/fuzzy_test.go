@@ -0,0 +1,44 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	_, positions, ok := store.FuzzyMatch("alb", "acme: login bug")
+	require.True(t, ok)
+	require.Equal(t, []int{0, 6, 12}, positions)
+
+	_, positions, ok = store.FuzzyMatch("log bug", "acme: login bug")
+	require.True(t, ok)
+	require.Equal(t, []int{6, 7, 8, 12, 13, 14}, positions)
+
+	_, _, ok = store.FuzzyMatch("bugs", "acme: login bug")
+	require.False(t, ok)
+
+	// Upper case makes the match case-sensitive.
+	_, _, ok = store.FuzzyMatch("Login", "acme: login bug")
+	require.False(t, ok)
+
+	_, _, ok = store.FuzzyMatch("", "anything")
+	require.True(t, ok)
+
+	// The shortest match ending at the first match is used.
+	_, positions, ok = store.FuzzyMatch("ab", "a-a-ab")
+	require.True(t, ok)
+	require.Equal(t, []int{4, 5}, positions)
+
+	// Consecutive runes and word starts rank higher.
+	score := func(pattern, s string) int {
+		score, _, ok := store.FuzzyMatch(pattern, s)
+		require.True(t, ok)
+		return score
+	}
+
+	require.Greater(t, score("login", "acme: login"), score("login", "acme: lots of going in"))
+	require.Greater(t, score("crash", "web: crash"), score("crash", "web: carts hash"))
+	require.Greater(t, score("wp", "web: preview"), score("wp", "web: swap"))
+}
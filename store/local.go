@@ -0,0 +1,77 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tomyl/xl"
+)
+
+// LocalDir is the name of the directory holding a per-directory database.
+const LocalDir = ".mort"
+
+// localIgnore keeps drafts and logs out of version control.
+const localIgnore = "draft/\nmort.log\n"
+
+// FindLocal looks for LocalDir/tasks.db in dir and its parents, like git
+// finds .git. It returns the LocalDir path or "" if there is none.
+func FindLocal(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		local := filepath.Join(dir, LocalDir)
+
+		if info, err := os.Stat(filepath.Join(local, "tasks.db")); err == nil && !info.IsDir() {
+			return local, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+
+		if parent == dir {
+			return "", nil
+		}
+
+		dir = parent
+	}
+}
+
+// InitLocal creates a per-directory database in dir and returns the
+// LocalDir path. An existing database is left untouched.
+func InitLocal(dir string) (string, error) {
+	local, err := filepath.Abs(filepath.Join(dir, LocalDir))
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(local, 0755); err != nil {
+		return "", err
+	}
+
+	ignore := filepath.Join(local, ".gitignore")
+
+	if _, err := os.Stat(ignore); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(ignore, []byte(localIgnore), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	db, err := xl.Connect("sqlite3", filepath.Join(local, "tasks.db"))
+
+	if err != nil {
+		return "", err
+	}
+
+	defer db.Close()
+
+	InitSchema(db)
+
+	return local, nil
+}
@@ -0,0 +1,39 @@
+package store_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+)
+
+func TestFindLocal(t *testing.T) {
+	root, err := ioutil.TempDir("", "mort")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	root, err = filepath.EvalSymlinks(root)
+	require.Nil(t, err)
+
+	sub := filepath.Join(root, "a", "b")
+	require.Nil(t, os.MkdirAll(sub, 0755))
+
+	local, err := store.FindLocal(sub)
+	require.Nil(t, err)
+	require.Equal(t, "", local)
+
+	local, err = store.InitLocal(root)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(root, store.LocalDir), local)
+
+	found, err := store.FindLocal(sub)
+	require.Nil(t, err)
+	require.Equal(t, local, found)
+
+	// Initializing again keeps the database.
+	_, err = store.InitLocal(root)
+	require.Nil(t, err)
+}
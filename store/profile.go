@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	xdg "github.com/queria/golang-go-xdg"
+)
+
+// DefaultProfile is used when no profile is selected. Its files are stored
+// directly in the mort data directory.
+const DefaultProfile = "default"
+
+var profileNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// CheckProfileName returns an error if name can't be used as profile name.
+func CheckProfileName(name string) error {
+	if !profileNameRe.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q, use letters, digits, - and _", name)
+	}
+	return nil
+}
+
+// ProfilePath returns the path of a file in the data directory of a profile,
+// e.g. tasks.db. Parent directories are created.
+func ProfilePath(profile, name string) (string, error) {
+	if profile == "" || profile == DefaultProfile {
+		return xdg.Data.Ensure(filepath.Join("mort", name))
+	}
+
+	if err := CheckProfileName(profile); err != nil {
+		return "", err
+	}
+
+	return xdg.Data.Ensure(filepath.Join("mort", "profiles", profile, name))
+}
+
+// Profiles returns the names of the default profile and all profiles that
+// have been used.
+func Profiles() ([]string, error) {
+	profiles := []string{DefaultProfile}
+
+	infos, err := ioutil.ReadDir(filepath.Join(xdg.Data.Home(), "mort", "profiles"))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profiles, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(infos))
+
+	for _, info := range infos {
+		if info.IsDir() && info.Name() != DefaultProfile && CheckProfileName(info.Name()) == nil {
+			names = append(names, info.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return append(profiles, names...), nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"strings"
+	"time"
+)
+
+// A Project summarizes the tasks of a project, see GetProjects.
+type Project struct {
+	Name string `db:"project" json:"project"`
+
+	// Open counts unarchived tasks that aren't in a done state, including
+	// tasks without state.
+	Open int64 `db:"open" json:"open"`
+
+	// Todo counts unarchived tasks with a state that isn't done.
+	Todo int64 `db:"todo" json:"todo"`
+
+	// Done counts unarchived tasks in a done state, see DoneStates.
+	Done int64 `db:"done" json:"done"`
+
+	Archived int64 `db:"archived" json:"archived"`
+
+	// Week and Month are the clocked time in seconds within the ranges
+	// passed to GetProjects.
+	Week  int64 `db:"week" json:"week"`
+	Month int64 `db:"month" json:"month"`
+
+	// LastActivity is the latest task update or clocked time.
+	LastActivity time.Time `db:"-" json:"last_activity"`
+}
+
+// GetProjects summarizes all projects, sorted by name. The clocked time is
+// counted within week and month.
+func (s *Store) GetProjects(week, month TimeRange) ([]Project, error) {
+	done := "(" + strings.TrimPrefix(strings.Repeat(",?", len(DoneStates)), ",") + ")"
+
+	q := `
+SELECT t.project, t.open, t.todo, t.done, t.archived,
+	COALESCE(c.week, 0) AS week, COALESCE(c.month, 0) AS month,
+	MAX(t.updated, COALESCE(c.clocked, 0)) AS last_activity
+FROM (
+	SELECT project,
+		SUM(archived_at IS NULL AND (state IS NULL OR state NOT IN ` + done + `)) AS open,
+		SUM(archived_at IS NULL AND state IS NOT NULL AND state NOT IN ` + done + `) AS todo,
+		SUM(archived_at IS NULL AND state IS NOT NULL AND state IN ` + done + `) AS done,
+		SUM(archived_at IS NOT NULL) AS archived,
+		MAX(CAST(strftime('%s', updated_at) AS INTEGER)) AS updated
+	FROM task GROUP BY project
+) t LEFT JOIN (
+	SELECT task.project,
+		SUM(` + clippedSQL + `) AS week,
+		SUM(` + clippedSQL + `) AS month,
+		MAX(CAST(strftime('%s', COALESCE(ts.clockout_at, current_timestamp)) AS INTEGER)) AS clocked
+	FROM timesheet ts JOIN task ON ts.task_id=task.id GROUP BY task.project
+) c ON c.project=t.project
+ORDER BY t.project COLLATE NOCASE`
+
+	params := make([]interface{}, 0)
+
+	for i := 0; i < 3; i++ {
+		for _, state := range DoneStates {
+			params = append(params, state)
+		}
+	}
+
+	params = append(params, week.End.Unix(), week.Start.Unix(), month.End.Unix(), month.Start.Unix())
+
+	var rows []struct {
+		Project
+		LastActivity int64 `db:"last_activity"`
+	}
+
+	if err := s.db.Select(&rows, q, params...); err != nil {
+		return nil, err
+	}
+
+	projects := make([]Project, len(rows))
+
+	for i, row := range rows {
+		projects[i] = row.Project
+		projects[i].LastActivity = time.Unix(row.LastActivity, 0).UTC()
+	}
+
+	return projects, nil
+}
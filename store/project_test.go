@@ -0,0 +1,68 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xl"
+	"github.com/tomyl/xl/testlogger"
+)
+
+func TestGetProjects(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	ids := make([]int64, 0)
+
+	for _, body := range []string{"acme: one", "acme: two", "acme: three", "acme: four", "web: five"} {
+		id, err := db.CreateTask(store.Task{Title: body, Project: store.GetProjectFromTitle(body), Body: body})
+		require.Nil(t, err)
+		ids = append(ids, id)
+	}
+
+	require.Nil(t, db.SetTodoState(ids[1], 0, "TODO"))
+	require.Nil(t, db.SetTodoState(ids[2], 2, "DONE"))
+	require.Nil(t, db.SetArchivedTasks(ids[3:4], true))
+
+	require.Nil(t, db.Clockin(ids[0]))
+	require.Nil(t, db.Clockout())
+
+	entries, err := db.GetTimesheet(store.TimeRange{End: time.Now().UTC().Add(time.Hour)})
+	require.Nil(t, err)
+	require.Equal(t, 1, len(entries))
+
+	// Two hours on the last day of a week that is in the middle of a month.
+	start := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	require.Nil(t, db.UpdateTimesheet(entries[0].ID, &start, &end))
+
+	week := store.TimeRange{Start: start.Add(-24 * time.Hour), End: start.Add(time.Hour)}
+	month := store.TimeRange{Start: start.AddDate(0, 0, -17), End: start.AddDate(0, 0, 14)}
+
+	projects, err := db.GetProjects(week, month)
+	require.Nil(t, err)
+	require.Equal(t, 2, len(projects))
+
+	acme := projects[0]
+	require.Equal(t, "acme", acme.Name)
+	require.Equal(t, int64(2), acme.Open)
+	require.Equal(t, int64(1), acme.Todo)
+	require.Equal(t, int64(1), acme.Done)
+	require.Equal(t, int64(1), acme.Archived)
+	require.Equal(t, int64(3600), acme.Week)
+	require.Equal(t, int64(7200), acme.Month)
+	require.True(t, acme.LastActivity.After(end))
+
+	web := projects[1]
+	require.Equal(t, "web", web.Name)
+	require.Equal(t, int64(1), web.Open)
+	require.Equal(t, int64(0), web.Week)
+}
@@ -0,0 +1,398 @@
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const queryDateFormat = "2006-01-02"
+
+// A queryTerm is a single term of a query, e.g. project:acme or -archived.
+type queryTerm struct {
+	key     string
+	value   string
+	negated bool
+
+	// literal terms were quoted and always search titles.
+	literal bool
+}
+
+// ParseQuery parses a query such as
+//
+//	project:acme state:TODO,WAIT -archived updated:>2026-09-01 "login bug"
+//
+// into a TaskQuery. Words without a field name search task titles.
+func ParseQuery(s string) (TaskQuery, error) {
+	terms, err := splitQuery(s)
+
+	if err != nil {
+		return TaskQuery{}, err
+	}
+
+	return parseTerms(terms)
+}
+
+// ParseQueryArgs is like ParseQuery but takes terms that are already split,
+// e.g. command-line arguments.
+func ParseQueryArgs(args []string) (TaskQuery, error) {
+	terms := make([]queryTerm, 0, len(args))
+
+	for _, arg := range args {
+		terms = append(terms, splitTerm(arg))
+	}
+
+	return parseTerms(terms)
+}
+
+func splitQuery(s string) ([]queryTerm, error) {
+	terms := make([]queryTerm, 0)
+
+	var word strings.Builder
+	inWord := false
+	inQuote := false
+	quoted := false
+	escaped := false
+
+	flush := func() {
+		if inWord {
+			if quoted && strings.HasPrefix(word.String(), "\x00") {
+				terms = append(terms, queryTerm{value: word.String()[1:], literal: true})
+			} else {
+				terms = append(terms, splitTerm(strings.Replace(word.String(), "\x00", "", 1)))
+			}
+		}
+		word.Reset()
+		inWord = false
+		quoted = false
+	}
+
+	for _, ch := range s {
+		switch {
+		case escaped:
+			word.WriteRune(ch)
+			escaped = false
+		case inQuote && ch == '\\':
+			escaped = true
+		case ch == '"':
+			if !inQuote && !inWord {
+				// Mark that the term starts with a quote.
+				word.WriteRune('\x00')
+			}
+			inQuote = !inQuote
+			inWord = true
+			quoted = true
+		case !inQuote && (ch == ' ' || ch == '\t' || ch == '\n'):
+			flush()
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	flush()
+
+	return terms, nil
+}
+
+func splitTerm(s string) queryTerm {
+	var term queryTerm
+
+	if strings.HasPrefix(s, "-") && len(s) > 1 {
+		term.negated = true
+		s = s[1:]
+	}
+
+	if idx := strings.Index(s, ":"); idx > 0 {
+		term.key = strings.ToLower(s[:idx])
+		term.value = s[idx+1:]
+	} else if isQueryKeyword(s) {
+		term.key = strings.ToLower(s)
+	} else {
+		if term.negated {
+			s = "-" + s
+			term.negated = false
+		}
+		term.value = s
+	}
+
+	return term
+}
+
+func isQueryKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "archived", "todo", "open", "estimated":
+		return true
+	}
+	return false
+}
+
+func parseTerms(terms []queryTerm) (TaskQuery, error) {
+	var query TaskQuery
+	words := make([]string, 0)
+
+	for _, term := range terms {
+		if term.literal || term.key == "" {
+			words = append(words, term.value)
+			continue
+		}
+
+		if term.negated && !isQueryKeyword(term.key) {
+			return query, fmt.Errorf("%s: negation not supported", term.key)
+		}
+
+		if isQueryKeyword(term.key) && term.value != "" {
+			return query, fmt.Errorf("%s: unexpected value %q", term.key, term.value)
+		}
+
+		if !isQueryKeyword(term.key) && term.value == "" {
+			return query, fmt.Errorf("%s: missing value", term.key)
+		}
+
+		var err error
+
+		switch term.key {
+		case "archived":
+			query.Archived = !term.negated
+		case "todo":
+			query.Todo = !term.negated
+		case "open":
+			query.Open = !term.negated
+		case "estimated":
+			query.Estimated = !term.negated
+		case "project":
+			query.Project = term.value
+		case "title":
+			words = append(words, term.value)
+		case "body":
+			query.SearchBody = term.value
+		case "state":
+			for _, state := range strings.Split(term.value, ",") {
+				state = strings.ToUpper(strings.TrimSpace(state))
+				if state == "NONE" {
+					state = ""
+				}
+				query.States = append(query.States, state)
+			}
+		case "parent":
+			if query.ParentID, err = strconv.ParseInt(term.value, 10, 64); err != nil {
+				return query, fmt.Errorf("parent: invalid id %q", term.value)
+			}
+		case "created":
+			err = parseDateBounds(term.value, &query.CreatedAfter, &query.CreatedBefore)
+		case "updated":
+			err = parseDateBounds(term.value, &query.UpdatedAfter, &query.UpdatedBefore)
+		case "date", "week":
+			var day time.Time
+			if day, err = parseQueryDate(term.value); err == nil {
+				var r TimeRange
+				r.Day(day)
+				if term.key == "week" {
+					r.Week()
+				}
+				query.Range = &r
+			}
+		case "sort":
+			query.Sort = strings.TrimPrefix(term.value, "-")
+			query.Reverse = strings.HasPrefix(term.value, "-")
+			if _, ok := sortFields[query.Sort]; !ok {
+				return query, fmt.Errorf("sort: unknown field %q", query.Sort)
+			}
+		case "limit":
+			if query.Limit, err = strconv.Atoi(term.value); err != nil || query.Limit < 0 {
+				return query, fmt.Errorf("limit: invalid number %q", term.value)
+			}
+		default:
+			return query, fmt.Errorf("unknown field %q", term.key)
+		}
+
+		if err != nil {
+			return query, fmt.Errorf("%s: %v", term.key, err)
+		}
+	}
+
+	query.SearchTitle = strings.Join(words, " ")
+
+	return query, nil
+}
+
+// parseQueryDate parses today, yesterday, tomorrow or a date in local time.
+func parseQueryDate(s string) (time.Time, error) {
+	today := beginningOfDay(time.Now())
+
+	switch strings.ToLower(s) {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+
+	t, err := time.ParseInLocation(queryDateFormat, s, time.Local)
+
+	if err != nil {
+		return t, fmt.Errorf("invalid date %q", s)
+	}
+
+	return t, nil
+}
+
+// parseDateBounds parses >D, >=D, <D, <=D or D, where D is a day, and
+// updates the affected bounds.
+func parseDateBounds(s string, after, before *time.Time) error {
+	op := ""
+
+	for _, prefix := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(s, prefix) {
+			op = prefix
+			s = s[len(prefix):]
+			break
+		}
+	}
+
+	day, err := parseQueryDate(s)
+
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case ">=":
+		*after = day
+	case ">":
+		*after = day.AddDate(0, 0, 1)
+	case "<=":
+		*before = day.AddDate(0, 0, 1)
+	case "<":
+		*before = day
+	default:
+		*after = day
+		*before = day.AddDate(0, 0, 1)
+	}
+
+	return nil
+}
+
+func formatDateBounds(after, before time.Time) string {
+	after = after.Local()
+	before = before.Local()
+
+	switch {
+	case after.IsZero():
+		return "<" + before.Format(queryDateFormat)
+	case before.IsZero():
+		return ">" + after.AddDate(0, 0, -1).Format(queryDateFormat)
+	case after.AddDate(0, 0, 1).Equal(before):
+		return after.Format(queryDateFormat)
+	}
+
+	return ">" + after.AddDate(0, 0, -1).Format(queryDateFormat) + " <" + before.Format(queryDateFormat)
+}
+
+func quoteQueryValue(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\"\\") {
+		return s
+	}
+	return quoteString(s)
+}
+
+func quoteString(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	return "\"" + s + "\""
+}
+
+// String formats the query in the syntax understood by ParseQuery.
+func (query TaskQuery) String() string {
+	terms := make([]string, 0)
+
+	if query.Project != "" {
+		terms = append(terms, "project:"+quoteQueryValue(query.Project))
+	}
+
+	if len(query.States) > 0 {
+		states := make([]string, len(query.States))
+		for i, state := range query.States {
+			if state == "" {
+				state = "none"
+			}
+			states[i] = state
+		}
+		terms = append(terms, "state:"+quoteQueryValue(strings.Join(states, ",")))
+	}
+
+	if query.Todo {
+		terms = append(terms, "todo")
+	}
+
+	if query.Open {
+		terms = append(terms, "open")
+	}
+
+	if query.Archived {
+		terms = append(terms, "archived")
+	}
+
+	if query.Estimated {
+		terms = append(terms, "estimated")
+	}
+
+	if query.ParentID > 0 {
+		terms = append(terms, fmt.Sprintf("parent:%d", query.ParentID))
+	}
+
+	if query.SearchBody != "" {
+		terms = append(terms, "body:"+quoteQueryValue(query.SearchBody))
+	}
+
+	if !query.CreatedAfter.IsZero() || !query.CreatedBefore.IsZero() {
+		for _, bound := range strings.Split(formatDateBounds(query.CreatedAfter, query.CreatedBefore), " ") {
+			terms = append(terms, "created:"+bound)
+		}
+	}
+
+	if !query.UpdatedAfter.IsZero() || !query.UpdatedBefore.IsZero() {
+		for _, bound := range strings.Split(formatDateBounds(query.UpdatedAfter, query.UpdatedBefore), " ") {
+			terms = append(terms, "updated:"+bound)
+		}
+	}
+
+	if query.Range != nil && !query.Range.IsZero() {
+		key := "date:"
+		if query.Range.Days > 1 {
+			key = "week:"
+		}
+		terms = append(terms, key+query.Range.Start.Local().Format(queryDateFormat))
+	}
+
+	if query.Sort != "" && query.Sort != "updated" || query.Reverse {
+		sort := query.Sort
+		if sort == "" {
+			sort = "updated"
+		}
+		if query.Reverse {
+			sort = "-" + sort
+		}
+		terms = append(terms, "sort:"+sort)
+	}
+
+	if query.Limit > 0 {
+		terms = append(terms, fmt.Sprintf("limit:%d", query.Limit))
+	}
+
+	if query.SearchTitle != "" {
+		title := query.SearchTitle
+		if strings.ContainsAny(title, ":\"\\") || strings.HasPrefix(title, "-") || isQueryKeyword(title) || strings.Contains(title, " ") {
+			title = quoteString(title)
+		}
+		terms = append(terms, title)
+	}
+
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,73 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := store.ParseQuery(`project:acme state:todo,WAIT -archived updated:>2026-09-01 "login bug"`)
+	require.Nil(t, err)
+	require.Equal(t, "acme", query.Project)
+	require.Equal(t, []string{"TODO", "WAIT"}, query.States)
+	require.False(t, query.Archived)
+	require.Equal(t, time.Date(2026, 9, 2, 0, 0, 0, 0, time.Local), query.UpdatedAfter)
+	require.True(t, query.UpdatedBefore.IsZero())
+	require.Equal(t, "login bug", query.SearchTitle)
+
+	query, err = store.ParseQuery(`archived todo body:"foo \"bar\"" parent:12 created:2026-09-01 week:2026-10-14 sort:-title limit:5 "todo"`)
+	require.Nil(t, err)
+	require.True(t, query.Archived)
+	require.True(t, query.Todo)
+	require.Equal(t, `foo "bar"`, query.SearchBody)
+	require.Equal(t, int64(12), query.ParentID)
+	require.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.Local), query.CreatedAfter)
+	require.Equal(t, time.Date(2026, 9, 2, 0, 0, 0, 0, time.Local), query.CreatedBefore)
+	require.NotNil(t, query.Range)
+	require.Equal(t, 7, query.Range.Days)
+	require.Equal(t, 12, query.Range.Start.Local().Day())
+	require.Equal(t, "title", query.Sort)
+	require.True(t, query.Reverse)
+	require.Equal(t, 5, query.Limit)
+	require.Equal(t, "todo", query.SearchTitle)
+
+	for _, s := range []string{
+		`bogus:1`,
+		`-project:acme`,
+		`project:`,
+		`todo:yes`,
+		`parent:x`,
+		`updated:>yesterdayish`,
+		`sort:bogus`,
+		`"unterminated`,
+	} {
+		_, err := store.ParseQuery(s)
+		require.NotNil(t, err, s)
+	}
+}
+
+func TestFormatQuery(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`project:acme state:TODO,WAIT updated:>2026-09-01 "login bug"`,
+		`project:"my project" state:none todo open archived estimated parent:3`,
+		`body:"a \"quoted\" word" created:2026-09-01 updated:>2026-09-01 updated:<2026-10-01`,
+		`date:2026-10-14 sort:-title limit:10 "todo"`,
+		`week:2026-10-12 login`,
+	} {
+		query, err := store.ParseQuery(s)
+		require.Nil(t, err, s)
+		require.Equal(t, s, query.String())
+	}
+}
+
+func TestParseQueryArgs(t *testing.T) {
+	query, err := store.ParseQueryArgs([]string{"project:my project", "-todo", "login bug"})
+	require.Nil(t, err)
+	require.Equal(t, "my project", query.Project)
+	require.False(t, query.Todo)
+	require.Equal(t, "login bug", query.SearchTitle)
+}
@@ -2,9 +2,8 @@ package store
 
 import "time"
 
-const (
-	dateFormat = "Jan 02 Mon"
-)
+// DateFormat is the layout used when formatting time ranges.
+var DateFormat = "Jan 02 Mon"
 
 // TimeRange reprents a date range.
 type TimeRange struct {
@@ -15,9 +14,9 @@ type TimeRange struct {
 
 func (r *TimeRange) String() string {
 	if r.Days <= 1 {
-		return r.Start.Local().Format(dateFormat)
+		return r.Start.Local().Format(DateFormat)
 	}
-	return r.Start.Local().Format(dateFormat) + " to " + r.End.Local().AddDate(0, 0, -1).Format(dateFormat)
+	return r.Start.Local().Format(DateFormat) + " to " + r.End.Local().AddDate(0, 0, -1).Format(DateFormat)
 }
 
 // IsZero returns true if the TimeRange hasn't been initialized.
@@ -39,12 +38,18 @@ func (r *TimeRange) Next() {
 
 // Today sets time range to today only.
 func (r *TimeRange) Today() {
+	r.Day(time.Now())
+}
+
+// Day sets time range to the day of provided time only.
+func (r *TimeRange) Day(t time.Time) {
 	r.Days = 1
-	r.Start = beginningOfDay(time.Now()).UTC()
+	r.Start = beginningOfDay(t).UTC()
 	r.End = r.Start.AddDate(0, 0, r.Days)
 }
 
-// Week sets time range to the week of currently selected start day.
+// Week sets time range to the week of currently selected start day. Weeks
+// start on Monday in local time.
 func (r *TimeRange) Week() {
 	if r.Start.IsZero() {
 		r.Start = beginningOfDay(time.Now()).UTC()
@@ -52,14 +57,34 @@ func (r *TimeRange) Week() {
 
 	r.Days = 7
 
-	wd := r.Start.Weekday()
+	day := r.Start.Local()
+	wd := day.Weekday()
 
-	if wd == 0 {
+	if wd == time.Sunday {
 		wd = 7
 	}
 
-	r.Start = r.Start.AddDate(0, 0, -int(wd))
-	r.End = r.Start.AddDate(0, 0, r.Days)
+	start := beginningOfDay(day).AddDate(0, 0, 1-int(wd))
+
+	r.Start = start.UTC()
+	r.End = start.AddDate(0, 0, r.Days).UTC()
+}
+
+// Month sets time range to the month of currently selected start day.
+func (r *TimeRange) Month() {
+	if r.Start.IsZero() {
+		r.Start = beginningOfDay(time.Now()).UTC()
+	}
+
+	year, month, _ := r.Start.Local().Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 1, 0)
+
+	r.Start = start.UTC()
+	r.End = end.UTC()
+
+	// Round since days aren't 24 hours when daylight saving time changes.
+	r.Days = int(end.Sub(start).Hours()/24 + 0.5)
 }
 
 func beginningOfDay(t time.Time) time.Time {
@@ -2,12 +2,14 @@ package store
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
-	xdg "github.com/queria/golang-go-xdg"
 	"github.com/tomyl/xl"
 )
 
@@ -48,7 +50,21 @@ CREATE TABLE IF NOT EXISTS migrate (
 );
 `
 
-// InitSchema creates the database schema.
+// Migrations are applied in order on top of Schema. The number of applied
+// migrations is tracked in the migrate table.
+var Migrations = []string{
+	`ALTER TABLE task ADD COLUMN estimate INTEGER`,
+	`UPDATE task SET state_idx=state_idx*1000 WHERE state_idx IS NOT NULL`,
+	`CREATE TABLE view (
+	id     INTEGER PRIMARY KEY,
+	name   TEXT NOT NULL UNIQUE,
+	query  TEXT NOT NULL,
+	search TEXT NOT NULL DEFAULT ''
+)`,
+	`CREATE INDEX task_parent ON task (parent_id)`,
+}
+
+// InitSchema creates the database schema and applies pending migrations.
 func InitSchema(db *xl.DB) {
 	statements := strings.Split(Schema, ";")
 	for _, statement := range statements {
@@ -59,67 +75,271 @@ func InitSchema(db *xl.DB) {
 			}
 		}
 	}
+
+	if err := migrate(db); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func migrate(db *xl.DB) error {
+	var version int
+	err := db.Get(&version, "SELECT version FROM migrate WHERE schema='mort'")
+
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for version < len(Migrations) {
+		if _, err := db.Exec(Migrations[version]); err != nil {
+			return err
+		}
+
+		version++
+
+		if _, err := db.Exec("INSERT OR REPLACE INTO migrate (schema, version) VALUES ('mort', ?)", version); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 type Task struct {
-	ID          int64      `db:"id"`
-	CreatedAt   time.Time  `db:"created_at"`
-	UpdatedAt   time.Time  `db:"updated_at"`
-	ScheduledAt *time.Time `db:"scheduled_at"`
-	ClockinAt   *time.Time `db:"clockin_at"`
-	ArchivedAt  *time.Time `db:"archived_at"`
-	PausedAt    *time.Time `db:"paused_at"`
-	ParentID    *int64     `db:"parent_id"`
-	Project     string     `db:"project"`
-	Title       string     `db:"title"`
-	Body        string     `db:"body"`
-	State       *string    `db:"state"`
-	StateIdx    *int       `db:"state_idx"`
-
-	ClockinAtOld *time.Time `db:"clockedin_at"`
+	ID          int64      `db:"id" json:"id"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+	ScheduledAt *time.Time `db:"scheduled_at" json:"scheduled_at"`
+	ClockinAt   *time.Time `db:"clockin_at" json:"clockin_at"`
+	ArchivedAt  *time.Time `db:"archived_at" json:"archived_at"`
+	PausedAt    *time.Time `db:"paused_at" json:"paused_at"`
+	ParentID    *int64     `db:"parent_id" json:"parent_id"`
+	Project     string     `db:"project" json:"project"`
+	Title       string     `db:"title" json:"title"`
+	Body        string     `db:"body" json:"body"`
+	State       *string    `db:"state" json:"state"`
+
+	// StateIdx orders tasks by todo state. It is the sort position of the
+	// state, see RenumberStates, times StateStride plus the position of the
+	// task among tasks in the same state, see ReorderTasks.
+	StateIdx *int `db:"state_idx" json:"state_idx"`
+
+	Estimate *int64 `db:"estimate" json:"estimate"`
+
+	// Spent is the clocked time in seconds, including child tasks. Only
+	// populated if requested in TaskQuery.
+	Spent int64 `db:"spent" json:"spent"`
+
+	// RangeSpent is like Spent but only counts time clocked within
+	// TaskQuery.SpentRange. Only populated if requested in TaskQuery.
+	RangeSpent int64 `db:"range_spent" json:"range_spent,omitempty"`
+
+	// Descendants is the number of child tasks, grandchild tasks and so on.
+	// Only populated if requested in TaskQuery.
+	Descendants int64 `db:"descendants" json:"descendants"`
+
+	ClockinAtOld *time.Time `db:"clockedin_at" json:"-"`
 }
 
+// StateStride separates the state_idx values of different todo states, see
+// Task.StateIdx.
+const StateStride = 1000
+
+// DoneStates are the todo states that count as done.
+var DoneStates = []string{"DONE"}
+
 type TaskQuery struct {
-	Project     string
-	Archived    bool
-	Todo        bool
-	ParentID    int64
+	Project  string
+	Archived bool
+	Todo     bool
+
+	// ParentID limits tasks to a task and all its descendants.
+	ParentID int64
+
 	SearchTitle string
 	SearchBody  string
 	Range       *TimeRange
+	Estimated   bool
+	Spent       bool
+	Descendants bool
+
+	// SpentRange populates Task.RangeSpent with the time clocked within the
+	// range.
+	SpentRange *TimeRange
+
+	// Open limits tasks to todo states that aren't in DoneStates.
+	Open bool
+
+	// States limits tasks to provided todo states. An empty string matches
+	// tasks without state.
+	States []string
+
+	// Zero values mean no bound.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	// Sort is one of SortFields. Defaults to "updated", or to state and then
+	// updated in Todo mode. Tasks that aren't scheduled or have no state sort
+	// last by scheduled and state.
+	Sort string
+
+	// Reverse reverses the natural order of Sort.
+	Reverse bool
+
+	// Limit is the maximum number of tasks to return. Zero means no limit.
+	Limit int
+}
+
+type sortField struct {
+	expr string
+	desc bool
+
+	// nulls sorts tasks without a value last in both directions.
+	nulls string
+}
+
+// sortFields maps sort names to SQL expressions and whether they sort in
+// descending order by default.
+var sortFields = map[string]sortField{
+	"id":        {"id", false, ""},
+	"created":   {"created_at", true, ""},
+	"updated":   {"updated_at", true, ""},
+	"scheduled": {"scheduled_at", false, "scheduled_at IS NULL"},
+	"project":   {"project COLLATE NOCASE", false, ""},
+	"state":     {"state_idx", false, "state_idx IS NULL"},
+	"title":     {"title COLLATE NOCASE", false, ""},
+	"spent":     {"spent", true, ""},
+}
+
+// SortFields returns the valid values of TaskQuery.Sort.
+func SortFields() []string {
+	names := make([]string, 0, len(sortFields))
+	for name := range sortFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SortOrder returns the name of the sort field and whether tasks are sorted
+// in descending order.
+func (query TaskQuery) SortOrder() (string, bool) {
+	name := query.Sort
+
+	if name == "" {
+		name = "updated"
+	}
+
+	return name, sortFields[name].desc != query.Reverse
+}
+
+func (query TaskQuery) orderBy() (string, error) {
+	name, desc := query.SortOrder()
+	field, ok := sortFields[name]
+
+	if !ok {
+		return "", fmt.Errorf("unknown sort %q", name)
+	}
+
+	expr := field.expr
+	direction := ""
+
+	if desc {
+		direction = " DESC"
+	}
+
+	expr += direction
+
+	if field.nulls != "" {
+		expr = field.nulls + ", " + expr
+	}
+
+	// Break ties by insertion order.
+	if name != "id" {
+		expr += ", id" + direction
+	}
+
+	// Todo mode sorts by state unless another order is asked for.
+	if query.Todo && query.Sort == "" {
+		expr = "state_idx, " + expr
+	}
+
+	return expr, nil
 }
 
 type TimesheetEntry struct {
-	ID         int64      `db:"id"`
-	TaskID     int64      `db:"task_id"`
-	ClockinAt  time.Time  `db:"clockin_at"`
-	ClockoutAt *time.Time `db:"clockout_at"`
+	ID         int64      `db:"id" json:"id"`
+	TaskID     int64      `db:"task_id" json:"task_id"`
+	ClockinAt  time.Time  `db:"clockin_at" json:"clockin_at"`
+	ClockoutAt *time.Time `db:"clockout_at" json:"clockout_at"`
 
-	Project string `db:"project"`
-	Title   string `db:"title"`
+	Project string `db:"project" json:"project"`
+	Title   string `db:"title" json:"title"`
 }
 
 type Store struct {
-	db *xl.DB
+	db      *xl.DB
+	profile string
+
+	// local is the directory of a per-directory database, see FindLocal.
+	local string
 }
 
 func New(db *xl.DB) *Store {
-	return &Store{db}
+	return &Store{db: db, profile: DefaultProfile}
 }
 
+// Default opens the database of the default profile. MORT_DB overrides the
+// database path. Otherwise a .mort/tasks.db in the current directory or one
+// of its parents is used before the database in the XDG data directory.
 func Default() (*Store, error) {
-	dbpath := os.Getenv("MORT_DB")
+	if dbpath := os.Getenv("MORT_DB"); dbpath != "" {
+		return open(dbpath, DefaultProfile, "")
+	}
 
-	if dbpath == "" {
-		filepath, err := xdg.Data.Ensure("mort/tasks.db")
+	cwd, err := os.Getwd()
 
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return nil, err
+	}
+
+	local, err := FindLocal(cwd)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if local != "" {
+		return open(filepath.Join(local, "tasks.db"), DefaultProfile, local)
+	}
+
+	dbpath, err := ProfilePath(DefaultProfile, "tasks.db")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dbpath, DefaultProfile, "")
+}
 
-		dbpath = filepath
+// Open opens the database of a profile. Other profiles than the default
+// profile are always stored in the XDG data directory.
+func Open(profile string) (*Store, error) {
+	if profile == "" || profile == DefaultProfile {
+		return Default()
 	}
 
+	dbpath, err := ProfilePath(profile, "tasks.db")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return open(dbpath, profile, "")
+}
+
+func open(dbpath, profile, local string) (*Store, error) {
 	db, err := xl.Connect("sqlite3", dbpath)
 
 	if err != nil {
@@ -128,18 +348,112 @@ func Default() (*Store, error) {
 
 	InitSchema(db)
 
-	store := &Store{db}
+	store := &Store{db, profile, local}
 
 	return store, nil
 }
 
+// Local returns the .mort directory if the store is a per-directory database.
+func (s *Store) Local() string {
+	return s.local
+}
+
+// DataPath returns the path of a file next to the database, e.g. mort.log.
+// Parent directories are created.
+func (s *Store) DataPath(name string) (string, error) {
+	if s.local != "" {
+		path := filepath.Join(s.local, name)
+		return path, os.MkdirAll(filepath.Dir(path), 0700)
+	}
+	return ProfilePath(s.profile, name)
+}
+
+// Profile returns the name of the profile the store belongs to.
+func (s *Store) Profile() string {
+	return s.profile
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// spentSQL sums the clocked seconds of a task and all its descendants. Open
+// timesheet entries count up to now.
+const spentSQL = `(
+	WITH RECURSIVE tree(id) AS (
+		SELECT task.id
+		UNION
+		SELECT child.id FROM task child JOIN tree ON child.parent_id=tree.id
+	)
+	SELECT COALESCE(SUM(strftime('%s', COALESCE(ts.clockout_at, current_timestamp)) - strftime('%s', ts.clockin_at)), 0)
+	FROM timesheet ts JOIN tree ON ts.task_id=tree.id
+) AS spent`
+
+// clippedSQL is the number of seconds of a timesheet entry ts that fall
+// within a range. The parameters are the end and start of the range as Unix
+// times.
+const clippedSQL = `MAX(0,
+		MIN(CAST(strftime('%s', COALESCE(ts.clockout_at, current_timestamp)) AS INTEGER), ?) -
+		MAX(CAST(strftime('%s', ts.clockin_at) AS INTEGER), ?))`
+
+// rangeSpentSQL is like spentSQL but only counts the part of each timesheet
+// entry that falls within a range, see clippedSQL.
+const rangeSpentSQL = `(
+	WITH RECURSIVE tree(id) AS (
+		SELECT task.id
+		UNION
+		SELECT child.id FROM task child JOIN tree ON child.parent_id=tree.id
+	)
+	SELECT COALESCE(SUM(` + clippedSQL + `), 0)
+	FROM timesheet ts JOIN tree ON ts.task_id=tree.id
+) AS range_spent`
+
+// descendantsSQL counts the descendants of a task.
+const descendantsSQL = `(
+	WITH RECURSIVE tree(id) AS (
+		SELECT child.id FROM task child WHERE child.parent_id=task.id
+		UNION
+		SELECT child.id FROM task child JOIN tree ON child.parent_id=tree.id
+	)
+	SELECT COUNT(*) FROM tree
+) AS descendants`
+
+// subtreeSQL selects the ids of a task and all its descendants.
+const subtreeSQL = `(
+	WITH RECURSIVE tree(id) AS (
+		SELECT ?
+		UNION
+		SELECT child.id FROM task child JOIN tree ON child.parent_id=tree.id
+	)
+	SELECT id FROM tree
+)`
+
 func (s *Store) GetTasks(query TaskQuery) ([]Task, error) {
-	q := xl.Select("*").From("task")
+	q := xl.Select("task.*").From("task")
 
-	if query.Todo {
-		q.OrderBy("state_idx, updated_at DESC")
-	} else {
-		q.OrderBy("updated_at DESC")
+	if query.Spent || query.Sort == "spent" {
+		q.Column(spentSQL)
+	}
+
+	if query.Descendants {
+		q.Column(descendantsSQL)
+	}
+
+	if query.SpentRange != nil {
+		q.Column(rangeSpentSQL, query.SpentRange.End.Unix(), query.SpentRange.Start.Unix())
+	}
+
+	orderBy, err := query.orderBy()
+
+	if err != nil {
+		return nil, err
+	}
+
+	q.OrderBy(orderBy)
+
+	if query.Limit > 0 {
+		q.LimitOffset(int64(query.Limit), 0)
 	}
 
 	if !query.Archived {
@@ -151,9 +465,7 @@ func (s *Store) GetTasks(query TaskQuery) ([]Task, error) {
 	}
 
 	if query.ParentID > 0 {
-		q.Where("(id=? OR parent_id=?)", query.ParentID, query.ParentID)
-	} else if query.ParentID == 0 {
-		//q.Where("parent_id IS NULL")
+		q.Where("id IN "+subtreeSQL, query.ParentID)
 	}
 
 	if query.SearchTitle != "" {
@@ -174,19 +486,73 @@ func (s *Store) GetTasks(query TaskQuery) ([]Task, error) {
 		q.Where("state_idx IS NOT NULL")
 	}
 
+	if query.Estimated {
+		q.Where("estimate IS NOT NULL")
+	}
+
+	if query.Open {
+		q.Where("state IS NOT NULL")
+		if len(DoneStates) > 0 {
+			params := make([]interface{}, len(DoneStates))
+			for i := range DoneStates {
+				params[i] = DoneStates[i]
+			}
+			q.Where("state NOT IN (?"+strings.Repeat(",?", len(DoneStates)-1)+")", params...)
+		}
+	}
+
+	if len(query.States) > 0 {
+		states := make([]string, 0)
+		params := make([]interface{}, 0)
+		for _, state := range query.States {
+			if state == "" {
+				states = append(states, "state IS NULL")
+			} else {
+				states = append(states, "state=?")
+				params = append(params, state)
+			}
+		}
+		q.Where("("+strings.Join(states, " OR ")+")", params...)
+	}
+
+	if !query.CreatedAfter.IsZero() {
+		q.Where("created_at >= ?", query.CreatedAfter.UTC())
+	}
+
+	if !query.CreatedBefore.IsZero() {
+		q.Where("created_at < ?", query.CreatedBefore.UTC())
+	}
+
+	if !query.UpdatedAfter.IsZero() {
+		q.Where("updated_at >= ?", query.UpdatedAfter.UTC())
+	}
+
+	if !query.UpdatedBefore.IsZero() {
+		q.Where("updated_at < ?", query.UpdatedBefore.UTC())
+	}
+
 	tasks := []Task{}
-	err := q.All(s.db, &tasks)
+	err = q.All(s.db, &tasks)
 
 	return tasks, err
 }
 
 func (s *Store) GetTaskByID(id int64) (*Task, error) {
 	var task Task
-	err := s.db.Get(&task, "SELECT * FROM task WHERE id=?", id)
+	err := s.db.Get(&task, "SELECT task.*, "+spentSQL+", "+descendantsSQL+" FROM task WHERE id=?", id)
 
 	return &task, err
 }
 
+// GetRangeSpent returns the time in seconds clocked on a task and its
+// descendants within r, see Task.RangeSpent.
+func (s *Store) GetRangeSpent(id int64, r TimeRange) (int64, error) {
+	var task Task
+	err := s.db.Get(&task, "SELECT task.id, "+rangeSpentSQL+" FROM task WHERE id=?", r.End.Unix(), r.Start.Unix(), id)
+
+	return task.RangeSpent, err
+}
+
 func (s *Store) CreateTask(payload Task) (int64, error) {
 	q := xl.Insert("task")
 	q.Set("project", payload.Project)
@@ -197,9 +563,24 @@ func (s *Store) CreateTask(payload Task) (int64, error) {
 		q.Set("parent_id", payload.ParentID)
 	}
 
+	if payload.ScheduledAt != nil {
+		q.Set("scheduled_at", payload.ScheduledAt.UTC())
+	}
+
+	if payload.State != nil && payload.StateIdx != nil {
+		q.Set("state", payload.State)
+		q.Set("state_idx", payload.StateIdx)
+	}
+
+	if payload.Estimate != nil && *payload.Estimate > 0 {
+		q.Set("estimate", payload.Estimate)
+	}
+
 	return q.ExecId(s.db)
 }
 
+// UpdateTaskByID updates the project, title and body of a task. Use SetParent
+// to change the parent.
 func (s *Store) UpdateTaskByID(id int64, payload Task) error {
 	q := xl.Update("task")
 	q.Where("id=?", id)
@@ -211,6 +592,66 @@ func (s *Store) UpdateTaskByID(id int64, payload Task) error {
 	return q.ExecOne(s.db)
 }
 
+// SetParent moves a task under another task. A non-positive parentID makes
+// the task a top-level task. Moving a task under itself, one of its
+// descendants or a task that doesn't exist is an error.
+func (s *Store) SetParent(id, parentID int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		var parent interface{}
+
+		if parentID > 0 {
+			var exists, cycle bool
+
+			if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM task WHERE id=?)", parentID).Scan(&exists); err != nil {
+				return err
+			}
+
+			if !exists {
+				return fmt.Errorf("parent task %d doesn't exist", parentID)
+			}
+
+			if err := tx.QueryRow("SELECT ? IN "+subtreeSQL, parentID, id).Scan(&cycle); err != nil {
+				return err
+			}
+
+			if cycle {
+				return fmt.Errorf("task %d can't be a subtask of itself or its descendants", id)
+			}
+
+			parent = parentID
+		}
+
+		res, err := tx.Exec("UPDATE task SET parent_id=?, updated_at=current_timestamp WHERE id=?", parent, id)
+
+		if err != nil {
+			return err
+		}
+
+		count, err := res.RowsAffected()
+
+		if err == nil && count != 1 {
+			err = fmt.Errorf("task %d doesn't exist", id)
+		}
+
+		return err
+	})
+}
+
+// SetEstimate sets the estimated duration of a task. A non-positive duration
+// clears the estimate.
+func (s *Store) SetEstimate(id int64, d time.Duration) error {
+	q := xl.Update("task")
+	q.Where("id=?", id)
+
+	if d > 0 {
+		q.Set("estimate", int64(d/time.Second))
+	} else {
+		q.SetNull("estimate")
+	}
+
+	return q.ExecOne(s.db)
+}
+
 func (s *Store) GetActiveTaskID() (int64, error) {
 	var id int64
 	q := xl.Select("id")
@@ -244,6 +685,8 @@ func (s *Store) GetPausedTaskID() (int64, error) {
 	return id, nil
 }
 
+// SetTodoState sets the todo state of a task. idx is the sort position of
+// state, see RenumberStates. A negative idx or empty state clears the state.
 func (s *Store) SetTodoState(id int64, idx int, state string) error {
 	tx, err := s.db.Begin()
 
@@ -258,7 +701,7 @@ func (s *Store) SetTodoState(id int64, idx int, state string) error {
 			return err
 		}
 	} else {
-		if _, err := tx.Exec("UPDATE task SET state_idx=?, state=? WHERE id=:id", idx, state, id); err != nil {
+		if _, err := tx.Exec("UPDATE task SET state_idx=?, state=? WHERE id=:id", idx*StateStride, state, id); err != nil {
 			return err
 		}
 	}
@@ -266,6 +709,83 @@ func (s *Store) SetTodoState(id int64, idx int, state string) error {
 	return tx.Commit()
 }
 
+// ReorderTasks makes tasks in the same todo state sort in the order of ids by
+// rewriting their state_idx. idxs holds the sort position of the state of each
+// task, see RenumberStates.
+func (s *Store) ReorderTasks(ids []int64, idxs []int) error {
+	if len(ids) != len(idxs) {
+		return fmt.Errorf("got %d tasks but %d state positions", len(ids), len(idxs))
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		for i, id := range ids {
+			if idxs[i] < 0 {
+				return fmt.Errorf("can't reorder task %d without state", id)
+			}
+			pos := i
+			if pos >= StateStride {
+				pos = StateStride - 1
+			}
+			if _, err := tx.Exec("UPDATE task SET state_idx=? WHERE id=? AND state IS NOT NULL", idxs[i]*StateStride+pos, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// RenumberStates rewrites the state part of state_idx, see Task.StateIdx, so
+// that tasks sort by ranks. ranks maps todo states to their sort position.
+// States that aren't in ranks sort after all others. Tasks keep their position
+// within their state.
+func (s *Store) RenumberStates(ranks map[string]int) error {
+	last := 0
+	for _, rank := range ranks {
+		if rank >= last {
+			last = rank + 1
+		}
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		var states []string
+
+		rows, err := tx.Query("SELECT DISTINCT state FROM task WHERE state IS NOT NULL")
+
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			var state string
+			if err := rows.Scan(&state); err != nil {
+				rows.Close()
+				return err
+			}
+			states = append(states, state)
+		}
+
+		if err := rows.Close(); err != nil {
+			return err
+		}
+
+		for _, state := range states {
+			rank, ok := ranks[state]
+			if !ok {
+				rank = last
+			}
+
+			_, err := tx.Exec("UPDATE task SET state_idx=?+IFNULL(state_idx, 0)%? WHERE state=? AND (state_idx IS NULL OR state_idx/?<>?)",
+				rank*StateStride, StateStride, state, StateStride, rank)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
 func (s *Store) Clockin(id int64) error {
 	tx, err := s.db.Begin()
 
@@ -361,8 +881,8 @@ func (s *Store) GetTimesheet(r TimeRange) ([]TimesheetEntry, error) {
 	q.FromAs("timesheet", "t")
 	q.FromAs("task", "n")
 	q.Where("t.task_id=n.id")
-	q.Where("t.clockin_at >= ?", r.Start)
-	q.Where("(t.clockout_at < ? OR (t.clockout_at IS NULL AND t.clockin_at < ?))", r.End, r.End)
+	q.Where("t.clockin_at >= ?", r.Start.UTC())
+	q.Where("(t.clockout_at < ? OR (t.clockout_at IS NULL AND t.clockin_at < ?))", r.End.UTC(), r.End.UTC())
 
 	err := q.All(s.db, &entries)
 
@@ -2,6 +2,7 @@ package store_test
 
 import (
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/require"
@@ -10,6 +11,25 @@ import (
 	"github.com/tomyl/xl/testlogger"
 )
 
+func TestMigrations(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	// Migrations are only applied once.
+	store.InitSchema(backenddb)
+	store.InitSchema(backenddb)
+
+	var version int
+	require.Nil(t, backenddb.Get(&version, "SELECT version FROM migrate WHERE schema='mort'"))
+	require.Equal(t, len(store.Migrations), version)
+
+	var index string
+	require.Nil(t, backenddb.Get(&index, "SELECT sql FROM sqlite_master WHERE type='index' AND name='task_parent'"))
+	require.Contains(t, index, "parent_id")
+}
+
 func TestTimesheet(t *testing.T) {
 	xl.SetLogger(testlogger.Simple(t))
 
@@ -155,3 +175,472 @@ func TestState(t *testing.T) {
 		require.Nil(t, task.State)
 	}
 }
+
+func TestReorderTasks(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	ids := make([]int64, 0)
+
+	for _, title := range []string{"a", "b", "c"} {
+		id, err := db.CreateTask(store.Task{Title: title, Body: title})
+		require.Nil(t, err)
+		require.Nil(t, db.SetTodoState(id, 0, "TODO"))
+		ids = append(ids, id)
+	}
+
+	titles := func() string {
+		tasks, err := db.GetTasks(store.TaskQuery{Todo: true, Sort: "state"})
+		require.Nil(t, err)
+		s := ""
+		for _, task := range tasks {
+			s += task.Title
+		}
+		return s
+	}
+
+	require.Equal(t, "abc", titles())
+
+	require.Nil(t, db.ReorderTasks([]int64{ids[2], ids[0], ids[1]}, []int{0, 0, 0}))
+	require.Equal(t, "cab", titles())
+
+	// Later states sort after all tasks in earlier states.
+	require.Nil(t, db.SetTodoState(ids[2], 1, "WAIT"))
+	require.Equal(t, "abc", titles())
+
+	require.Nil(t, db.ReorderTasks([]int64{ids[1], ids[0]}, []int{0, 0}))
+	require.Equal(t, "bac", titles())
+
+	require.NotNil(t, db.ReorderTasks(ids, []int{0}))
+	require.NotNil(t, db.ReorderTasks(ids[:1], []int{-1}))
+}
+
+func TestRenumberStates(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	ids := make([]int64, 0)
+
+	for i, title := range []string{"a", "b", "c"} {
+		id, err := db.CreateTask(store.Task{Title: title, Body: title})
+		require.Nil(t, err)
+		require.Nil(t, db.SetTodoState(id, i, []string{"TODO", "WAIT", "DONE"}[i]))
+		ids = append(ids, id)
+	}
+
+	require.Nil(t, db.ReorderTasks([]int64{ids[1]}, []int{1}))
+	_, err = backenddb.Exec("UPDATE task SET state_idx=state_idx+7 WHERE id=?", ids[1])
+	require.Nil(t, err)
+
+	titles := func() string {
+		tasks, err := db.GetTasks(store.TaskQuery{Todo: true})
+		require.Nil(t, err)
+		s := ""
+		for _, task := range tasks {
+			s += task.Title
+		}
+		return s
+	}
+
+	require.Equal(t, "abc", titles())
+
+	// DONE is no longer in any workflow and sorts last.
+	require.Nil(t, db.RenumberStates(map[string]int{"WAIT": 0, "TODO": 1}))
+	require.Equal(t, "bac", titles())
+
+	task, err := db.GetTaskByID(ids[1])
+	require.Nil(t, err)
+	require.Equal(t, 7, *task.StateIdx)
+
+	task, err = db.GetTaskByID(ids[2])
+	require.Nil(t, err)
+	require.Equal(t, 2*store.StateStride, *task.StateIdx)
+}
+
+func TestEstimate(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	parentID, err := db.CreateTask(store.Task{Title: "parent"})
+	require.Nil(t, err)
+
+	childID, err := db.CreateTask(store.Task{Title: "child", ParentID: &parentID})
+	require.Nil(t, err)
+
+	require.Nil(t, db.SetEstimate(parentID, 2*time.Hour))
+
+	start := time.Now().Add(-3 * time.Hour)
+	end := start.Add(time.Hour)
+
+	for _, id := range []int64{parentID, childID} {
+		require.Nil(t, db.Clockin(id))
+		require.Nil(t, db.Clockout())
+	}
+
+	entries, err := db.GetTimesheet(store.TimeRange{Start: start, End: time.Now().Add(time.Hour)})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+
+	for _, e := range entries {
+		require.Nil(t, db.UpdateTimesheet(e.ID, &start, &end))
+	}
+
+	{
+		tasks, err := db.GetTasks(store.TaskQuery{Estimated: true, Spent: true})
+		require.Nil(t, err)
+		require.Equal(t, 1, len(tasks))
+		require.NotNil(t, tasks[0].Estimate)
+		require.Equal(t, int64(7200), *tasks[0].Estimate)
+		require.Equal(t, int64(7200), tasks[0].Spent)
+	}
+
+	{
+		task, err := db.GetTaskByID(childID)
+		require.Nil(t, err)
+		require.Nil(t, task.Estimate)
+		require.Equal(t, int64(3600), task.Spent)
+	}
+
+	require.Nil(t, db.SetEstimate(parentID, 0))
+
+	{
+		task, err := db.GetTaskByID(parentID)
+		require.Nil(t, err)
+		require.Nil(t, task.Estimate)
+	}
+}
+
+func TestRangeSpent(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	parentID, err := db.CreateTask(store.Task{Title: "parent"})
+	require.Nil(t, err)
+
+	childID, err := db.CreateTask(store.Task{Title: "child", ParentID: &parentID})
+	require.Nil(t, err)
+
+	for _, id := range []int64{parentID, childID} {
+		require.Nil(t, db.Clockin(id))
+		require.Nil(t, db.Clockout())
+	}
+
+	entries, err := db.GetTimesheet(store.TimeRange{End: time.Now().UTC().Add(time.Hour)})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(entries))
+
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+
+	for _, e := range entries {
+		require.Nil(t, db.UpdateTimesheet(e.ID, &start, &end))
+	}
+
+	// Only the second hour of each entry is within the range.
+	r := store.TimeRange{Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)}
+
+	tasks, err := db.GetTasks(store.TaskQuery{Spent: true, SpentRange: &r, Sort: "id"})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tasks))
+	require.Equal(t, int64(4*3600), tasks[0].Spent)
+	require.Equal(t, int64(2*3600), tasks[0].RangeSpent)
+	require.Equal(t, int64(3600), tasks[1].RangeSpent)
+
+	spent, err := db.GetRangeSpent(childID, r)
+	require.Nil(t, err)
+	require.Equal(t, int64(3600), spent)
+
+	// Entries outside the range don't count.
+	r = store.TimeRange{Start: end, End: end.Add(time.Hour)}
+
+	spent, err = db.GetRangeSpent(parentID, r)
+	require.Nil(t, err)
+	require.Equal(t, int64(0), spent)
+}
+
+func TestCreateTask(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	parentID, err := db.CreateTask(store.Task{Title: "parent"})
+	require.Nil(t, err)
+
+	state := "WAIT"
+	stateIdx := 1*store.StateStride + 2
+	estimate := int64(1800)
+	scheduled := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	var payload store.Task
+	payload.Project = "acme"
+	payload.Title = "acme: child"
+	payload.Body = "acme: child\n\nDetails."
+	payload.ParentID = &parentID
+	payload.State = &state
+	payload.StateIdx = &stateIdx
+	payload.Estimate = &estimate
+	payload.ScheduledAt = &scheduled
+
+	id, err := db.CreateTask(payload)
+	require.Nil(t, err)
+
+	task, err := db.GetTaskByID(id)
+	require.Nil(t, err)
+	require.Equal(t, payload.Body, task.Body)
+	require.Equal(t, parentID, *task.ParentID)
+	require.Equal(t, "WAIT", *task.State)
+	require.Equal(t, stateIdx, *task.StateIdx)
+	require.Equal(t, estimate, *task.Estimate)
+	require.True(t, scheduled.Equal(*task.ScheduledAt))
+
+	// A task that is read back can be created again as is.
+	id, err = db.CreateTask(*task)
+	require.Nil(t, err)
+
+	task, err = db.GetTaskByID(id)
+	require.Nil(t, err)
+	require.Equal(t, stateIdx, *task.StateIdx)
+}
+
+func TestSort(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	for _, title := range []string{"b", "C", "a"} {
+		_, err := db.CreateTask(store.Task{Title: title})
+		require.Nil(t, err)
+	}
+
+	titles := func(query store.TaskQuery) []string {
+		tasks, err := db.GetTasks(query)
+		require.Nil(t, err)
+		result := make([]string, 0)
+		for _, task := range tasks {
+			result = append(result, task.Title)
+		}
+		return result
+	}
+
+	require.Equal(t, []string{"a", "C", "b"}, titles(store.TaskQuery{}))
+	require.Equal(t, []string{"b", "C", "a"}, titles(store.TaskQuery{Sort: "created", Reverse: true}))
+	require.Equal(t, []string{"a", "b", "C"}, titles(store.TaskQuery{Sort: "title"}))
+	require.Equal(t, []string{"C", "b"}, titles(store.TaskQuery{Sort: "title", Reverse: true, Limit: 2}))
+
+	_, err = db.GetTasks(store.TaskQuery{Sort: "bogus"})
+	require.NotNil(t, err)
+
+	tasks, err := db.GetTasks(store.TaskQuery{Sort: "title"})
+	require.Nil(t, err)
+
+	// a is scheduled, b is TODO and C has clocked time.
+	scheduled := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	_, err = backenddb.Exec("UPDATE task SET scheduled_at=? WHERE id=?", scheduled, tasks[0].ID)
+	require.Nil(t, err)
+	require.Nil(t, db.SetTodoState(tasks[1].ID, 0, "TODO"))
+	require.Nil(t, db.Clockin(tasks[2].ID))
+	_, err = backenddb.Exec("UPDATE timesheet SET clockin_at=datetime('now', '-1 hour')")
+	require.Nil(t, err)
+
+	require.Equal(t, "a", titles(store.TaskQuery{Sort: "scheduled"})[0])
+	require.Equal(t, "a", titles(store.TaskQuery{Sort: "scheduled", Reverse: true})[0])
+	require.Equal(t, "b", titles(store.TaskQuery{Sort: "state"})[0])
+	require.Equal(t, "b", titles(store.TaskQuery{Sort: "state", Reverse: true})[0])
+	require.Equal(t, "C", titles(store.TaskQuery{Sort: "spent"})[0])
+	require.Equal(t, "C", titles(store.TaskQuery{Sort: "spent", Reverse: true})[2])
+
+	// Todo mode sorts by state unless sorted by something else.
+	require.Nil(t, db.SetTodoState(tasks[0].ID, 1, "WAIT"))
+	require.Equal(t, []string{"b", "a"}, titles(store.TaskQuery{Todo: true}))
+	require.Equal(t, []string{"a", "b"}, titles(store.TaskQuery{Todo: true, Sort: "title"}))
+
+	name, desc := store.TaskQuery{Sort: "spent", Reverse: true}.SortOrder()
+	require.Equal(t, "spent", name)
+	require.False(t, desc)
+}
+
+func TestWeek(t *testing.T) {
+	// Sunday is the last day of its week, and the week of October 25 has 25
+	// hours where daylight saving time ends that day.
+	for _, c := range []struct {
+		day   int
+		start int
+		end   int
+	}{
+		{12, 12, 19},
+		{14, 12, 19},
+		{18, 12, 19},
+		{25, 19, 26},
+	} {
+		var r store.TimeRange
+		r.Day(time.Date(2026, 10, c.day, 12, 0, 0, 0, time.Local))
+		r.Week()
+		require.Equal(t, time.Monday, r.Start.Local().Weekday())
+		require.Equal(t, c.start, r.Start.Local().Day())
+		require.Equal(t, c.end, r.End.Local().Day())
+		require.Equal(t, 0, r.End.Local().Hour())
+	}
+}
+
+func TestMonth(t *testing.T) {
+	for _, c := range []struct {
+		month time.Month
+		days  int
+	}{{time.February, 28}, {time.October, 31}, {time.December, 31}} {
+		var r store.TimeRange
+		r.Day(time.Date(2026, c.month, 15, 12, 0, 0, 0, time.Local))
+		r.Month()
+		require.Equal(t, 1, r.Start.Local().Day())
+		require.Equal(t, c.month, r.Start.Local().Month())
+		require.Equal(t, 1, r.End.Local().Day())
+		require.Equal(t, c.days, r.Days)
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	for i, state := range []string{"TODO", "WAIT", "DONE", ""} {
+		id, err := db.CreateTask(store.Task{Title: state})
+		require.Nil(t, err)
+		require.Nil(t, db.SetTodoState(id, i, state))
+	}
+
+	count := func(s string) int {
+		query, err := store.ParseQuery(s)
+		require.Nil(t, err)
+		tasks, err := db.GetTasks(query)
+		require.Nil(t, err)
+		return len(tasks)
+	}
+
+	require.Equal(t, 4, count(""))
+	require.Equal(t, 2, count("state:todo,wait"))
+	require.Equal(t, 1, count("state:none"))
+	require.Equal(t, 3, count("todo"))
+	require.Equal(t, 2, count("open"))
+	require.Equal(t, 4, count("updated:>=today"))
+	require.Equal(t, 0, count("updated:<today"))
+	require.Equal(t, 4, count("created:<tomorrow"))
+}
+
+func TestDescendants(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	rootID, err := db.CreateTask(store.Task{Title: "root"})
+	require.Nil(t, err)
+
+	childID, err := db.CreateTask(store.Task{Title: "child", ParentID: &rootID})
+	require.Nil(t, err)
+
+	_, err = db.CreateTask(store.Task{Title: "grandchild", ParentID: &childID})
+	require.Nil(t, err)
+
+	_, err = db.CreateTask(store.Task{Title: "other"})
+	require.Nil(t, err)
+
+	tasks, err := db.GetTasks(store.TaskQuery{ParentID: rootID, Descendants: true, Sort: "id"})
+	require.Nil(t, err)
+	require.Equal(t, 3, len(tasks))
+
+	descendants := make(map[string]int64)
+	for _, task := range tasks {
+		descendants[task.Title] = task.Descendants
+	}
+	require.Equal(t, map[string]int64{"root": 2, "child": 1, "grandchild": 0}, descendants)
+
+	tasks, err = db.GetTasks(store.TaskQuery{ParentID: childID})
+	require.Nil(t, err)
+	require.Equal(t, 2, len(tasks))
+
+	task, err := db.GetTaskByID(rootID)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), task.Descendants)
+}
+
+func TestSetParent(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	rootID, err := db.CreateTask(store.Task{Title: "root"})
+	require.Nil(t, err)
+
+	childID, err := db.CreateTask(store.Task{Title: "child", ParentID: &rootID})
+	require.Nil(t, err)
+
+	otherID, err := db.CreateTask(store.Task{Title: "other"})
+	require.Nil(t, err)
+
+	require.NotNil(t, db.SetParent(rootID, rootID))
+	require.NotNil(t, db.SetParent(rootID, childID))
+	require.NotNil(t, db.SetParent(rootID, otherID+1))
+	require.NotNil(t, db.SetParent(otherID+1, rootID))
+
+	require.Nil(t, db.SetParent(childID, otherID))
+
+	task, err := db.GetTaskByID(childID)
+	require.Nil(t, err)
+	require.Equal(t, otherID, *task.ParentID)
+
+	require.Nil(t, db.SetParent(rootID, childID))
+
+	require.Nil(t, db.SetParent(childID, 0))
+
+	task, err = db.GetTaskByID(childID)
+	require.Nil(t, err)
+	require.Nil(t, task.ParentID)
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// A Snapshot holds copies of task rows and their timesheet entries so that a
+// change can be undone, see Restore.
+type Snapshot struct {
+	// taskIDs are the covered tasks, including tasks that don't exist.
+	taskIDs []int64
+
+	tasks     rowSet
+	timesheet rowSet
+}
+
+// A rowSet holds rows with all values as text, which SQLite converts back
+// to the column types on insert.
+type rowSet struct {
+	columns []string
+	rows    [][]sql.NullString
+}
+
+// Snapshot copies the rows of tasks ids and their timesheet entries. The
+// active and paused tasks are always included since clocking in changes
+// them, and so are the children of the tasks since deleting reparents them.
+func (s *Store) Snapshot(ids []int64) (*Snapshot, error) {
+	snap := &Snapshot{}
+	seen := make(map[int64]bool)
+
+	add := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			snap.taskIDs = append(snap.taskIDs, id)
+		}
+	}
+
+	for _, id := range ids {
+		add(id)
+	}
+
+	var related []int64
+
+	q := "SELECT id FROM task WHERE clockin_at IS NOT NULL OR paused_at IS NOT NULL"
+	params := make([]interface{}, 0)
+
+	if len(snap.taskIDs) > 0 {
+		q += " OR parent_id IN (?" + strings.Repeat(",?", len(snap.taskIDs)-1) + ")"
+		for _, id := range snap.taskIDs {
+			params = append(params, id)
+		}
+	}
+
+	if err := s.db.Select(&related, q, params...); err != nil {
+		return nil, err
+	}
+
+	for _, id := range related {
+		add(id)
+	}
+
+	return s.snapshot(snap)
+}
+
+// SnapshotAfter takes the snapshot after a change. It covers the same tasks
+// as before plus created tasks.
+func (s *Store) SnapshotAfter(before *Snapshot, created ...int64) (*Snapshot, error) {
+	snap := &Snapshot{taskIDs: append(append([]int64{}, before.taskIDs...), created...)}
+	return s.snapshot(snap)
+}
+
+func (s *Store) snapshot(snap *Snapshot) (*Snapshot, error) {
+	if len(snap.taskIDs) == 0 {
+		return snap, nil
+	}
+
+	var err error
+
+	if snap.tasks, err = s.selectRows("task", "id", snap.taskIDs); err != nil {
+		return nil, err
+	}
+
+	if snap.timesheet, err = s.selectRows("timesheet", "task_id", snap.taskIDs); err != nil {
+		return nil, err
+	}
+
+	return snap, nil
+}
+
+func (s *Store) selectRows(table, key string, ids []int64) (rowSet, error) {
+	var set rowSet
+
+	if err := s.db.Select(&set.columns, "SELECT name FROM pragma_table_info(?)", table); err != nil {
+		return set, err
+	}
+
+	exprs := make([]string, len(set.columns))
+	for i, column := range set.columns {
+		exprs[i] = fmt.Sprintf("CAST(%s AS TEXT)", column)
+	}
+
+	params := make([]interface{}, len(ids))
+	for i, id := range ids {
+		params[i] = id
+	}
+
+	q := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (?%s)", strings.Join(exprs, ", "), table, key, strings.Repeat(",?", len(ids)-1))
+	rows, err := s.db.Query(q, params...)
+
+	if err != nil {
+		return set, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		row := make([]sql.NullString, len(set.columns))
+		dest := make([]interface{}, len(row))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return set, err
+		}
+		set.rows = append(set.rows, row)
+	}
+
+	return set, rows.Err()
+}
+
+// Restore puts the tasks covered by snap or other back in the state they
+// had in snap. Tasks that didn't exist in snap are deleted. To undo a change,
+// restore the snapshot taken before it with the snapshot taken after it (see
+// SnapshotAfter) as other, and the other way around to redo it.
+func (s *Store) Restore(snap, other *Snapshot) error {
+	ids := append([]int64{}, snap.taskIDs...)
+	if other != nil {
+		ids = append(ids, other.taskIDs...)
+	}
+
+	return s.inTx(func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM timesheet WHERE task_id=?", id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("DELETE FROM task WHERE id=?", id); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range []struct {
+			table string
+			set   rowSet
+		}{{"task", snap.tasks}, {"timesheet", snap.timesheet}} {
+			if err := insertRows(tx, item.table, item.set); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func insertRows(tx *sql.Tx, table string, set rowSet) error {
+	if len(set.rows) == 0 {
+		return nil
+	}
+
+	q := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s)", table, strings.Join(set.columns, ", "), strings.Repeat(",?", len(set.columns)-1))
+
+	for _, row := range set.rows {
+		params := make([]interface{}, len(row))
+		for i := range row {
+			params[i] = row[i]
+		}
+		if _, err := tx.Exec(q, params...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
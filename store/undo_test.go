@@ -0,0 +1,109 @@
+package store_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xl"
+	"github.com/tomyl/xl/testlogger"
+)
+
+func TestUndo(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	parentID, err := db.CreateTask(store.Task{Title: "parent", Body: "parent"})
+	require.Nil(t, err)
+
+	childID, err := db.CreateTask(store.Task{Title: "child", Body: "child", ParentID: &parentID})
+	require.Nil(t, err)
+
+	require.Nil(t, db.SetEstimate(parentID, time.Hour))
+	require.Nil(t, db.Clockin(childID))
+
+	// Clocking in on the parent clocks out from the child.
+	before, err := db.Snapshot([]int64{parentID})
+	require.Nil(t, err)
+
+	require.Nil(t, db.Clockin(parentID))
+
+	after, err := db.SnapshotAfter(before)
+	require.Nil(t, err)
+
+	active := func() int64 {
+		id, err := db.GetActiveTaskID()
+		require.Nil(t, err)
+		return id
+	}
+
+	entries := func() int {
+		var n int
+		require.Nil(t, backenddb.Get(&n, "SELECT COUNT(*) FROM timesheet"))
+		return n
+	}
+
+	require.Equal(t, parentID, active())
+	require.Equal(t, 2, entries())
+
+	require.Nil(t, db.Restore(before, after))
+	require.Equal(t, childID, active())
+	require.Equal(t, 1, entries())
+
+	require.Nil(t, db.Restore(after, before))
+	require.Equal(t, parentID, active())
+	require.Equal(t, 2, entries())
+
+	// Undo a created task.
+	before, err = db.Snapshot(nil)
+	require.Nil(t, err)
+
+	newID, err := db.CreateTask(store.Task{Title: "new", Body: "new"})
+	require.Nil(t, err)
+
+	after, err = db.SnapshotAfter(before, newID)
+	require.Nil(t, err)
+
+	require.Nil(t, db.Restore(before, after))
+	_, err = db.GetTaskByID(newID)
+	require.NotNil(t, err)
+
+	// Undo a deleted task with children.
+	before, err = db.Snapshot([]int64{parentID})
+	require.Nil(t, err)
+
+	require.Nil(t, db.DeleteTasks([]int64{parentID}))
+
+	after, err = db.SnapshotAfter(before)
+	require.Nil(t, err)
+
+	require.Nil(t, db.Restore(before, after))
+
+	task, err := db.GetTaskByID(childID)
+	require.Nil(t, err)
+	require.Equal(t, parentID, *task.ParentID)
+	require.Equal(t, parentID, active())
+	require.Equal(t, 2, entries())
+
+	require.Nil(t, db.Restore(after, before))
+
+	task, err = db.GetTaskByID(childID)
+	require.Nil(t, err)
+	require.Nil(t, task.ParentID)
+	require.Equal(t, int64(0), active())
+	require.Equal(t, 1, entries())
+
+	// Restored rows keep all columns.
+	require.Nil(t, db.Restore(before, after))
+
+	task, err = db.GetTaskByID(parentID)
+	require.Nil(t, err)
+	require.Equal(t, int64(3600), *task.Estimate)
+}
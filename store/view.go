@@ -0,0 +1,103 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/tomyl/xl"
+)
+
+// A View is a saved set of task filters.
+type View struct {
+	ID   int64  `db:"id" json:"-"`
+	Name string `db:"name" json:"name"`
+
+	// Query is in the syntax of ParseQuery.
+	Query string `db:"query" json:"query"`
+
+	// Search is a pattern for FuzzyMatch that narrows the tasks further.
+	Search string `db:"search" json:"search,omitempty"`
+}
+
+// TaskQuery parses the query of the view.
+func (v *View) TaskQuery() (TaskQuery, error) {
+	query, err := ParseQuery(v.Query)
+
+	if err != nil {
+		return query, fmt.Errorf("view %s: %v", v.Name, err)
+	}
+
+	return query, nil
+}
+
+// CheckViewName returns an error if name can't be used as a view name.
+func CheckViewName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty view name")
+	}
+
+	if strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("invalid view name %q", name)
+	}
+
+	return nil
+}
+
+// SaveView creates a view, or replaces the query and search of the view with
+// the same name. The query is checked with ParseQuery.
+func (s *Store) SaveView(v View) error {
+	if err := CheckViewName(v.Name); err != nil {
+		return err
+	}
+
+	if _, err := v.TaskQuery(); err != nil {
+		return err
+	}
+
+	q := xl.Update("view")
+	q.Where("name=?", v.Name)
+	q.Set("query", v.Query)
+	q.Set("search", v.Search)
+
+	if n, err := q.ExecCount(s.db); err != nil || n > 0 {
+		return err
+	}
+
+	ins := xl.Insert("view")
+	ins.Set("name", v.Name)
+	ins.Set("query", v.Query)
+	ins.Set("search", v.Search)
+
+	return ins.ExecErr(s.db)
+}
+
+// GetView returns the view with the given name, or nil if there is none.
+func (s *Store) GetView(name string) (*View, error) {
+	var v View
+
+	if err := s.db.Get(&v, "SELECT * FROM view WHERE name=?", name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+// GetViews returns all views in the order they were created.
+func (s *Store) GetViews() ([]View, error) {
+	views := []View{}
+	err := s.db.Select(&views, "SELECT * FROM view ORDER BY id")
+
+	return views, err
+}
+
+// DeleteView deletes the view with the given name.
+func (s *Store) DeleteView(name string) error {
+	q := xl.Delete("view")
+	q.Where("name=?", name)
+
+	return q.ExecOne(s.db)
+}
@@ -0,0 +1,64 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xl"
+	"github.com/tomyl/xl/testlogger"
+)
+
+func TestViews(t *testing.T) {
+	xl.SetLogger(testlogger.Simple(t))
+
+	backenddb, err := xl.Open("sqlite3", ":memory:")
+	require.Nil(t, err)
+
+	store.InitSchema(backenddb)
+
+	db := store.New(backenddb)
+
+	views, err := db.GetViews()
+	require.Nil(t, err)
+	require.Equal(t, 0, len(views))
+
+	require.Nil(t, db.SaveView(store.View{Name: "acme", Query: "project:acme todo"}))
+	require.Nil(t, db.SaveView(store.View{Name: "week", Query: "week:today", Search: "login"}))
+
+	require.NotNil(t, db.SaveView(store.View{Name: "", Query: "todo"}))
+	require.NotNil(t, db.SaveView(store.View{Name: "two words", Query: "todo"}))
+	require.NotNil(t, db.SaveView(store.View{Name: "bad", Query: "nosuch:field"}))
+
+	// Saving under an existing name replaces the view but keeps its place.
+	require.Nil(t, db.SaveView(store.View{Name: "acme", Query: "project:acme open", Search: "bug"}))
+
+	views, err = db.GetViews()
+	require.Nil(t, err)
+	require.Equal(t, 2, len(views))
+	require.Equal(t, "acme", views[0].Name)
+	require.Equal(t, "project:acme open", views[0].Query)
+	require.Equal(t, "bug", views[0].Search)
+	require.Equal(t, "week", views[1].Name)
+
+	v, err := db.GetView("acme")
+	require.Nil(t, err)
+	require.NotNil(t, v)
+
+	query, err := v.TaskQuery()
+	require.Nil(t, err)
+	require.Equal(t, "acme", query.Project)
+	require.True(t, query.Open)
+
+	v, err = db.GetView("nosuch")
+	require.Nil(t, err)
+	require.Nil(t, v)
+
+	require.Nil(t, db.DeleteView("acme"))
+	require.NotNil(t, db.DeleteView("acme"))
+
+	views, err = db.GetViews()
+	require.Nil(t, err)
+	require.Equal(t, 1, len(views))
+	require.Equal(t, "week", views[0].Name)
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tomyl/gocui"
+)
+
+// A style describes how text is displayed.
+type style struct {
+	// Fg and Bg are color names or 256-color palette numbers, see
+	// parseColor. Empty means the terminal default.
+	Fg string `toml:"fg"`
+	Bg string `toml:"bg"`
+
+	Bold      bool `toml:"bold"`
+	Underline bool `toml:"underline"`
+	Reverse   bool `toml:"reverse"`
+}
+
+// themeConfig selects a built-in theme and overrides parts of it.
+type themeConfig struct {
+	// Name is one of the built-in themes: dark, light or mono.
+	Name string `toml:"name"`
+
+	// Styles overrides styleNames. Styles named state.NAME override the
+	// workflow color of state NAME.
+	Styles map[string]style `toml:"styles"`
+
+	// Colors maps color names or numbers to other colors, e.g. to make
+	// yellow readable on a light background.
+	Colors map[string]string `toml:"colors"`
+}
+
+// styleNames are the styles a theme defines.
+var styleNames = []string{"active", "archived", "marked", "match", "overdue", "status", "selection"}
+
+// A theme is a resolved set of styles.
+type theme struct {
+	styles map[string]style
+	colors map[string]string
+
+	// mono themes don't use colors and show markers instead, e.g. ! after
+	// exceeded estimates.
+	mono bool
+}
+
+var themes = map[string]theme{
+	"dark": {
+		styles: map[string]style{
+			"active":    {Bold: true},
+			"archived":  {Fg: "240"},
+			"marked":    {Fg: "yellow", Bold: true},
+			"match":     {Fg: "cyan", Bold: true},
+			"overdue":   {Fg: "red"},
+			"status":    {Fg: "white", Bg: "blue"},
+			"selection": {Fg: "black", Bg: "green"},
+		},
+	},
+	"light": {
+		styles: map[string]style{
+			"active":    {Bold: true},
+			"archived":  {Fg: "247"},
+			"marked":    {Fg: "yellow", Bold: true},
+			"match":     {Fg: "cyan", Bold: true},
+			"overdue":   {Fg: "160"},
+			"status":    {Fg: "white", Bg: "24"},
+			"selection": {Fg: "black", Bg: "152"},
+		},
+		colors: map[string]string{
+			"yellow":  "136",
+			"green":   "28",
+			"cyan":    "30",
+			"magenta": "127",
+			"white":   "240",
+		},
+	},
+	"mono": {
+		styles: map[string]style{
+			"active":    {Bold: true},
+			"marked":    {Underline: true},
+			"match":     {Bold: true, Underline: true},
+			"overdue":   {Bold: true},
+			"status":    {Reverse: true},
+			"selection": {Reverse: true},
+		},
+		mono: true,
+	},
+}
+
+const ansiReset = "\033[0m"
+
+var colorNames = []string{"black", "red", "green", "yellow", "blue", "magenta", "cyan", "white"}
+
+// parseColor returns the 256-color palette index of a color name or number.
+func parseColor(name string) (int, error) {
+	for i, colorName := range colorNames {
+		if strings.ToLower(name) == colorName {
+			return i, nil
+		}
+	}
+
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 && n <= 255 {
+		return n, nil
+	}
+
+	return 0, fmt.Errorf("unknown color %q, expected one of %s or 0-255", name, strings.Join(colorNames, ", "))
+}
+
+func (s style) validate() error {
+	for _, color := range []string{s.Fg, s.Bg} {
+		if color != "" {
+			if _, err := parseColor(color); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// newTheme resolves the styles of tc. Colors are dropped if $NO_COLOR is set.
+func newTheme(tc themeConfig) (*theme, error) {
+	base, ok := themes[tc.Name]
+
+	if !ok {
+		names := make([]string, 0, len(themes))
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("name: unknown theme %q, expected one of %s", tc.Name, strings.Join(names, ", "))
+	}
+
+	t := &theme{
+		styles: make(map[string]style),
+		colors: make(map[string]string),
+		mono:   base.mono || os.Getenv("NO_COLOR") != "",
+	}
+
+	if t.mono && !base.mono {
+		base = themes["mono"]
+	}
+
+	for name, s := range base.styles {
+		t.styles[name] = s
+	}
+
+	for name, color := range base.colors {
+		t.colors[name] = color
+	}
+
+	for name, color := range tc.Colors {
+		if _, err := parseColor(name); err != nil {
+			return nil, fmt.Errorf("colors.%s: %v", name, err)
+		}
+		if _, err := parseColor(color); err != nil {
+			return nil, fmt.Errorf("colors.%s: %v", name, err)
+		}
+		t.colors[strings.ToLower(name)] = color
+	}
+
+	for name, s := range tc.Styles {
+		if !isStyleName(name) {
+			return nil, fmt.Errorf("styles: unknown style %q, expected one of %s or state.NAME", name, strings.Join(styleNames, ", "))
+		}
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("styles.%s: %v", name, err)
+		}
+		t.styles[name] = s
+	}
+
+	return t, nil
+}
+
+func isStyleName(name string) bool {
+	if strings.HasPrefix(name, "state.") && len(name) > len("state.") {
+		return true
+	}
+	for _, styleName := range styleNames {
+		if name == styleName {
+			return true
+		}
+	}
+	return false
+}
+
+// color returns the palette index of color after applying the theme's color
+// mapping, or -1 if colors are disabled or color is empty.
+func (t *theme) color(color string) int {
+	if t.mono || color == "" {
+		return -1
+	}
+	if mapped, ok := t.colors[strings.ToLower(color)]; ok {
+		color = mapped
+	}
+	n, err := parseColor(color)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// ansi returns the escape sequence for s. Colors go first since gocui resets
+// attributes when parsing 256-color sequences.
+func (t *theme) ansi(s style) string {
+	var b strings.Builder
+
+	if n := t.color(s.Fg); n >= 0 {
+		if n < 8 {
+			fmt.Fprintf(&b, "\033[3%dm", n)
+		} else {
+			fmt.Fprintf(&b, "\033[38;5;%dm", n)
+		}
+	}
+
+	if n := t.color(s.Bg); n >= 0 {
+		if n < 8 {
+			fmt.Fprintf(&b, "\033[4%dm", n)
+		} else {
+			fmt.Fprintf(&b, "\033[48;5;%dm", n)
+		}
+	}
+
+	if s.Bold {
+		b.WriteString("\033[1m")
+	}
+
+	if s.Underline {
+		b.WriteString("\033[4m")
+	}
+
+	if s.Reverse {
+		b.WriteString("\033[7m")
+	}
+
+	return b.String()
+}
+
+// style returns the escape sequence of the named style.
+func (t *theme) style(name string) string {
+	return t.ansi(t.styles[name])
+}
+
+// attributes returns the named style as gocui attributes.
+func (t *theme) attributes(name string) (fg, bg gocui.Attribute) {
+	s := t.styles[name]
+	fg = gocui.ColorDefault
+	bg = gocui.ColorDefault
+
+	if n := t.color(s.Fg); n >= 0 {
+		fg = gocui.Attribute(n + 1)
+	}
+
+	if n := t.color(s.Bg); n >= 0 {
+		bg = gocui.Attribute(n + 1)
+	}
+
+	if s.Bold {
+		fg |= gocui.AttrBold
+	}
+
+	if s.Underline {
+		fg |= gocui.AttrUnderline
+	}
+
+	if s.Reverse {
+		fg |= gocui.AttrReverse
+	}
+
+	return fg, bg
+}
+
+// stateStyle returns the escape sequence for state. Unless the theme has a
+// state.NAME style, the color of the state in the project's workflow is used,
+// falling back to other workflows.
+func (t *theme) stateStyle(project, state string) string {
+	if s, ok := t.styles["state."+state]; ok {
+		return t.ansi(s)
+	}
+
+	workflows := []*workflow{getWorkflow(project)}
+	for _, w := range conf.Workflows {
+		workflows = append(workflows, w)
+	}
+
+	for _, w := range workflows {
+		if idx := w.stateIndex(state); idx >= 0 {
+			return t.ansi(style{Fg: w.States[idx].Color})
+		}
+	}
+
+	return ""
+}
+
+// setSelectionStyle applies the selection style to a view.
+func (t *theme) setSelectionStyle(view *gocui.View) {
+	if view != nil {
+		view.SelFgColor, view.SelBgColor = t.attributes("selection")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/mort/store"
+)
+
+// An undoEntry is a change that can be undone and redone.
+type undoEntry struct {
+	// desc describes the change, e.g. "archive 3 tasks".
+	desc string
+
+	before *store.Snapshot
+	after  *store.Snapshot
+}
+
+// maxUndo limits the number of changes that can be undone.
+const maxUndo = 100
+
+// change runs f, which changes the tasks ids, and makes it undoable.
+func (app *mortApp) change(desc string, ids []int64, f func() error) error {
+	before, err := app.db.Snapshot(ids)
+
+	if err != nil {
+		return err
+	}
+
+	if err := f(); err != nil {
+		return err
+	}
+
+	return app.recordChange(desc, before, nil)
+}
+
+// recordChange makes a change undoable after it has been made. before is the
+// snapshot taken before the change and created are the tasks it created.
+func (app *mortApp) recordChange(desc string, before *store.Snapshot, created []int64) error {
+	after, err := app.db.SnapshotAfter(before, created...)
+
+	if err != nil {
+		return fmt.Errorf("can't undo %s: %v", desc, err)
+	}
+
+	app.undo = append(app.undo, undoEntry{desc, before, after})
+
+	if len(app.undo) > maxUndo {
+		app.undo = app.undo[len(app.undo)-maxUndo:]
+	}
+
+	app.redo = nil
+
+	return nil
+}
+
+// clearUndo forgets all changes, e.g. when switching to another database.
+func (app *mortApp) clearUndo() {
+	app.undo = nil
+	app.redo = nil
+}
+
+func (app *mortApp) undoChange(g *gocui.Gui) {
+	if len(app.undo) == 0 {
+		app.setMessage("Nothing to undo.")
+		return
+	}
+
+	e := app.undo[len(app.undo)-1]
+
+	if err := app.db.Restore(e.before, e.after); err != nil {
+		app.setMessage("Failed to undo %s: %v", e.desc, err)
+		return
+	}
+
+	app.undo = app.undo[:len(app.undo)-1]
+	app.redo = append(app.redo, e)
+	app.reloadView(g)
+	app.setMessage("Undid %s.", e.desc)
+}
+
+func (app *mortApp) redoChange(g *gocui.Gui) {
+	if len(app.redo) == 0 {
+		app.setMessage("Nothing to redo.")
+		return
+	}
+
+	e := app.redo[len(app.redo)-1]
+
+	if err := app.db.Restore(e.after, e.before); err != nil {
+		app.setMessage("Failed to redo %s: %v", e.desc, err)
+		return
+	}
+
+	app.redo = app.redo[:len(app.redo)-1]
+	app.undo = append(app.undo, e)
+	app.reloadView(g)
+	app.setMessage("Redid %s.", e.desc)
+}
+
+// reloadView reloads the screen that is shown.
+func (app *mortApp) reloadView(g *gocui.Gui) {
+	switch g.CurrentView() {
+	case app.timesheet.View():
+		app.loadTimesheet()
+	case app.board.View():
+		app.loadBoard()
+	case app.projects.View():
+		app.loadProjects()
+	case app.views.View():
+		app.loadViews()
+	default:
+		app.loadTasks()
+	}
+}
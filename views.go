@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/tomyl/gocui"
+	"github.com/tomyl/mort/store"
+	"github.com/tomyl/xui"
+)
+
+// viewsWidget lists the saved views. The first line is a header.
+type viewsWidget struct {
+	base  xui.ListWidget
+	views []store.View
+}
+
+func (w *viewsWidget) View() *gocui.View {
+	return w.base.View()
+}
+
+func (w *viewsWidget) SetView(view *gocui.View) {
+	w.base.Highlight = true
+	w.base.SetView(view)
+	conf.theme.setSelectionStyle(view)
+}
+
+// SetModel replaces the views, keeping the selected view if it still exists.
+func (w *viewsWidget) SetModel(views []store.View) {
+	name := ""
+	if v := w.CurrentView(); v != nil {
+		name = v.Name
+	}
+
+	w.views = views
+	w.base.SetModel(formatViews(views))
+
+	current := 0
+	for i := range views {
+		if views[i].Name == name {
+			current = i
+		}
+	}
+
+	w.base.SetCurrent(current + 1)
+}
+
+// CurrentView returns the selected view or nil if the header is selected.
+func (w *viewsWidget) CurrentView() *store.View {
+	idx := w.base.Current() - 1
+	if idx >= 0 && idx < len(w.views) {
+		return &w.views[idx]
+	}
+	return nil
+}
+
+func (w *viewsWidget) HandleAction(action string) error {
+	return w.base.HandleAction(action)
+}
+
+// formatViews formats views as a numbered table with a header. The numbers
+// are the keys that recall the views.
+func formatViews(views []store.View) []string {
+	row := "%3s %-20s %-12s %s"
+	lines := []string{fmt.Sprintf(row, "#", "VIEW", "SEARCH", "QUERY")}
+
+	for i, v := range views {
+		search := v.Search
+		if search == "" {
+			search = "-"
+		}
+		lines = append(lines, fmt.Sprintf(row, fmt.Sprintf("%d", i+1), v.Name, search, v.Query))
+	}
+
+	return lines
+}
+
+// formatViewQuery formats query for a saved view. A day or week range that
+// includes today is saved as today's so that the view follows the calendar.
+func formatViewQuery(query store.TaskQuery) string {
+	r := query.Range
+	query.Range = nil
+
+	terms := make([]string, 0, 2)
+
+	if s := query.String(); s != "" {
+		terms = append(terms, s)
+	}
+
+	if r != nil && !r.IsZero() {
+		var current store.TimeRange
+		current.Today()
+		key := "date:"
+
+		if r.Days > 1 {
+			current.Week()
+			key = "week:"
+		}
+
+		day := r.Start.Local().Format("2006-01-02")
+
+		if current.Start.Equal(r.Start) {
+			day = "today"
+		}
+
+		terms = append(terms, key+day)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+func (app *mortApp) showViewsView() {
+	app.gx.Focus(app.views.View())
+	app.loadViews()
+}
+
+func (app *mortApp) loadViews() {
+	views, err := app.db.GetViews()
+
+	if err != nil {
+		app.setMessage("Failed to load views: %v", err)
+		return
+	}
+
+	app.views.SetModel(views)
+	app.setStatus(fmt.Sprintf("%d views", len(views)))
+}
+
+// saveView saves the task filters and the search pattern under a name. The
+// name of the last recalled view is suggested.
+func (app *mortApp) saveView(g *gocui.Gui) {
+	v := store.View{
+		Query:  formatViewQuery(app.Filter),
+		Search: app.tasks.Pattern(),
+	}
+
+	callback := func(success bool, response string) {
+		if !success {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		v.Name = strings.TrimSpace(response)
+
+		if err := app.db.SaveView(v); err != nil {
+			app.setMessage("Failed to save view: %v", err)
+			return
+		}
+
+		log.Printf("Saved view %s: %s", v.Name, v.Query)
+
+		app.viewName = v.Name
+		app.setMessage("Saved view %s.", v.Name)
+	}
+
+	app.prompt.SetPrompt(g, "Save view as: ", app.viewName, callback)
+}
+
+// applyView replaces the task filters and the search pattern with those of a
+// view and shows the tasks.
+func (app *mortApp) applyView(v *store.View) {
+	query, err := v.TaskQuery()
+
+	if err != nil {
+		app.setMessage("Invalid view: %v", err)
+		return
+	}
+
+	if query.Range != nil {
+		app.Range = *query.Range
+		query.Range = &app.Range
+	}
+
+	app.Filter = query
+	app.viewName = v.Name
+	app.tasks.SetPattern(v.Search)
+	app.showTasksView()
+	app.setMessage("View %s.", v.Name)
+}
+
+// openView applies the selected view.
+func (app *mortApp) openView() {
+	v := app.views.CurrentView()
+
+	if v == nil {
+		app.setMessage("No view.")
+		return
+	}
+
+	app.applyView(v)
+}
+
+// recallView applies the nth view, counting from 1.
+func (app *mortApp) recallView(n int) {
+	views, err := app.db.GetViews()
+
+	if err != nil {
+		app.setMessage("Failed to load views: %v", err)
+		return
+	}
+
+	if n < 1 || n > len(views) {
+		app.setMessage("No view %d.", n)
+		return
+	}
+
+	app.applyView(&views[n-1])
+}
+
+func (app *mortApp) deleteView(g *gocui.Gui) {
+	v := app.views.CurrentView()
+
+	if v == nil {
+		app.setMessage("No view.")
+		return
+	}
+
+	name := v.Name
+
+	callback := func(success bool, response string) {
+		if !success || strings.ToLower(strings.TrimSpace(response)) != "y" {
+			app.setMessage("Cancelled.")
+			return
+		}
+
+		if err := app.db.DeleteView(name); err != nil {
+			app.setMessage("Failed to delete view: %v", err)
+			return
+		}
+
+		log.Printf("Deleted view %s", name)
+
+		if app.viewName == name {
+			app.viewName = ""
+		}
+
+		app.loadViews()
+		app.setMessage("Deleted view %s.", name)
+	}
+
+	app.prompt.SetPrompt(g, fmt.Sprintf("Delete view %s? (y/n): ", name), "", callback)
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/tomyl/gocui"
 	"github.com/tomyl/mort/store"
@@ -12,8 +15,40 @@ import (
 )
 
 type tasksWidget struct {
-	base  xui.ScrollWidget
+	base xui.ScrollWidget
+
+	// model holds the visible tasks, in tree order in tree mode.
 	model []store.Task
+
+	// tasks holds all loaded tasks.
+	tasks []store.Task
+
+	// tree indents tasks under their parent.
+	tree bool
+
+	// depths holds the indentation level of each task in model.
+	depths []int
+
+	// children counts the loaded children of each task.
+	children map[int64]int
+
+	// collapsed tasks hide their descendants in tree mode.
+	collapsed map[int64]bool
+
+	// marked tasks are changed by bulk operations.
+	marked map[int64]bool
+
+	// rangeSpent shows Task.RangeSpent instead of Task.Spent in the spent
+	// column.
+	rangeSpent bool
+
+	// pattern narrows the visible tasks to those with titles that fuzzy
+	// match it, see store.FuzzyMatch.
+	pattern string
+
+	// matches holds the matched rune positions in the title of each task
+	// matching pattern.
+	matches map[int64][]int
 }
 
 func (w *tasksWidget) View() *gocui.View {
@@ -23,6 +58,7 @@ func (w *tasksWidget) View() *gocui.View {
 func (w *tasksWidget) SetView(view *gocui.View) {
 	w.base.Highlight = true
 	w.base.SetView(view)
+	conf.theme.setSelectionStyle(view)
 	w.render()
 }
 
@@ -30,12 +66,343 @@ func (w *tasksWidget) Model() []store.Task {
 	return w.model
 }
 
-func (w *tasksWidget) SetModel(model []store.Task) {
-	w.base.SetMax(len(model))
+// Tasks returns all loaded tasks, including those hidden in collapsed
+// subtrees.
+func (w *tasksWidget) Tasks() []store.Task {
+	return w.tasks
+}
+
+func (w *tasksWidget) SetModel(tasks []store.Task) {
+	w.tasks = tasks
+
+	// Tasks that are no longer loaded can't be seen, so don't keep them
+	// marked.
+	loaded := make(map[int64]bool, len(tasks))
+	for _, task := range tasks {
+		loaded[task.ID] = true
+	}
+	for id := range w.marked {
+		if !loaded[id] {
+			delete(w.marked, id)
+		}
+	}
+
+	w.rebuild()
+}
+
+// Matching returns the loaded tasks that match the search pattern.
+func (w *tasksWidget) Matching() []store.Task {
+	if w.pattern == "" {
+		return w.tasks
+	}
+
+	tasks := make([]store.Task, 0, len(w.matches))
+	for _, task := range w.tasks {
+		if _, ok := w.matches[task.ID]; ok {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// Pattern returns the search pattern.
+func (w *tasksWidget) Pattern() string {
+	return w.pattern
+}
+
+// SetPattern narrows the visible tasks to those matching pattern, best
+// matches first, and selects the best match. In tree mode the ancestors of
+// matching tasks are shown too, in query order, and collapsed tasks are
+// expanded. An empty pattern shows all tasks.
+func (w *tasksWidget) SetPattern(pattern string) {
+	if pattern == w.pattern {
+		return
+	}
+	w.pattern = pattern
+	w.rebuild()
+	w.SetCurrent(0)
+}
+
+// Marked returns the marked tasks in list order.
+func (w *tasksWidget) Marked() []store.Task {
+	marked := make([]store.Task, 0, len(w.marked))
+	for _, task := range w.tasks {
+		if w.marked[task.ID] {
+			marked = append(marked, task)
+		}
+	}
+	return marked
+}
+
+// ToggleMark marks or unmarks the selected task.
+func (w *tasksWidget) ToggleMark() {
+	if task := w.CurrentTask(); task != nil {
+		w.setMarked(task.ID, !w.marked[task.ID])
+		w.render()
+	}
+}
+
+// MarkAll marks all matching tasks, or unmarks them if they are already
+// marked.
+func (w *tasksWidget) MarkAll() {
+	tasks := w.Matching()
+	mark := false
+	for _, task := range tasks {
+		if !w.marked[task.ID] {
+			mark = true
+		}
+	}
+	for _, task := range tasks {
+		w.setMarked(task.ID, mark)
+	}
+	w.render()
+}
+
+// InvertMarks marks the matching tasks that aren't marked and unmarks the
+// rest.
+func (w *tasksWidget) InvertMarks() {
+	for _, task := range w.Matching() {
+		w.setMarked(task.ID, !w.marked[task.ID])
+	}
+	w.render()
+}
+
+// ClearMarks unmarks all tasks.
+func (w *tasksWidget) ClearMarks() {
+	w.marked = nil
+	w.render()
+}
+
+func (w *tasksWidget) setMarked(id int64, marked bool) {
+	if w.marked == nil {
+		w.marked = make(map[int64]bool)
+	}
+	if marked {
+		w.marked[id] = true
+	} else {
+		delete(w.marked, id)
+	}
+}
+
+// rebuild updates the visible tasks after the loaded tasks, the tree state or
+// the search pattern changed.
+func (w *tasksWidget) rebuild() {
+	w.children = make(map[int64]int)
+	tasks := w.search()
+
+	if !w.tree {
+		w.model = tasks
+		w.depths = nil
+		w.base.SetMax(len(w.model))
+		w.render()
+		return
+	}
+
+	loaded := make(map[int64]bool, len(tasks))
+	for _, task := range tasks {
+		loaded[task.ID] = true
+	}
+
+	// Children keep the query order. Tasks whose parent isn't loaded are
+	// shown as roots.
+	kids := make(map[int64][]int)
+	roots := make([]int, 0)
+
+	for i, task := range tasks {
+		if task.ParentID != nil && *task.ParentID != task.ID && loaded[*task.ParentID] {
+			kids[*task.ParentID] = append(kids[*task.ParentID], i)
+			w.children[*task.ParentID]++
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	model := make([]store.Task, 0, len(tasks))
+	depths := make([]int, 0, len(tasks))
+	visited := make(map[int]bool)
+
+	var visit func(i, depth int, hidden bool)
+	visit = func(i, depth int, hidden bool) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		task := tasks[i]
+		if !hidden {
+			model = append(model, task)
+			depths = append(depths, depth)
+		}
+		collapsed := w.collapsed[task.ID] && w.pattern == ""
+		for _, child := range kids[task.ID] {
+			visit(child, depth+1, hidden || collapsed)
+		}
+	}
+
+	for _, i := range roots {
+		visit(i, 0, false)
+	}
+
+	// Tasks in a parent cycle are never reached from a root.
+	for i := range tasks {
+		visit(i, 0, false)
+	}
+
 	w.model = model
+	w.depths = depths
+	w.base.SetMax(len(w.model))
 	w.render()
 }
 
+// search returns the loaded tasks matching the search pattern and records the
+// matched positions. Without tree mode the best matches come first. In tree
+// mode the ancestors of matching tasks are included and the query order is
+// kept.
+func (w *tasksWidget) search() []store.Task {
+	w.matches = nil
+
+	if w.pattern == "" {
+		return w.tasks
+	}
+
+	type match struct {
+		idx   int
+		score int
+	}
+
+	found := make([]match, 0)
+	w.matches = make(map[int64][]int)
+
+	for i, task := range w.tasks {
+		if score, positions, ok := store.FuzzyMatch(w.pattern, task.Title); ok {
+			w.matches[task.ID] = positions
+			found = append(found, match{i, score})
+		}
+	}
+
+	if !w.tree {
+		sort.SliceStable(found, func(a, b int) bool {
+			return found[a].score > found[b].score
+		})
+
+		tasks := make([]store.Task, len(found))
+		for i, m := range found {
+			tasks[i] = w.tasks[m.idx]
+		}
+		return tasks
+	}
+
+	byID := make(map[int64]*store.Task, len(w.tasks))
+	for i := range w.tasks {
+		byID[w.tasks[i].ID] = &w.tasks[i]
+	}
+
+	keep := make(map[int64]bool)
+
+	for id := range w.matches {
+		for !keep[id] {
+			task, ok := byID[id]
+			if !ok {
+				break
+			}
+			keep[id] = true
+			if task.ParentID == nil {
+				break
+			}
+			id = *task.ParentID
+		}
+	}
+
+	tasks := make([]store.Task, 0, len(keep))
+	for _, task := range w.tasks {
+		if keep[task.ID] {
+			tasks = append(tasks, task)
+		}
+	}
+	return tasks
+}
+
+// Tree reports whether tree mode is enabled.
+func (w *tasksWidget) Tree() bool {
+	return w.tree
+}
+
+// SetRangeSpent selects whether the spent column shows the time clocked
+// within the task query range or in total.
+func (w *tasksWidget) SetRangeSpent(rangeSpent bool) {
+	w.rangeSpent = rangeSpent
+}
+
+// SetTree enables or disables tree mode, keeping the selected task.
+func (w *tasksWidget) SetTree(tree bool) {
+	var current int64
+	if task := w.CurrentTask(); task != nil {
+		current = task.ID
+	}
+
+	w.tree = tree
+	w.rebuild()
+
+	if current > 0 {
+		w.SetCurrentByTaskID(current)
+	}
+}
+
+// ToggleCollapsed collapses or expands the selected task in tree mode. Tasks
+// without children collapse their parent instead.
+func (w *tasksWidget) ToggleCollapsed() {
+	task := w.CurrentTask()
+
+	if !w.tree || task == nil {
+		return
+	}
+
+	id := task.ID
+
+	if w.children[id] == 0 {
+		if task.ParentID == nil || w.GetTaskIndexByID(*task.ParentID) < 0 {
+			return
+		}
+		id = *task.ParentID
+	}
+
+	if w.collapsed == nil {
+		w.collapsed = make(map[int64]bool)
+	}
+
+	w.collapsed[id] = !w.collapsed[id]
+	w.rebuild()
+	w.SetCurrentByTaskID(id)
+}
+
+// ExpandAll expands all collapsed tasks.
+func (w *tasksWidget) ExpandAll() {
+	w.collapsed = nil
+	w.rebuild()
+}
+
+// Reveal expands the collapsed ancestors of a loaded task.
+func (w *tasksWidget) Reveal(id int64) {
+	if !w.tree || w.GetTaskIndexByID(id) >= 0 {
+		return
+	}
+
+	parents := make(map[int64]int64, len(w.tasks))
+	for _, task := range w.tasks {
+		if task.ParentID != nil {
+			parents[task.ID] = *task.ParentID
+		}
+	}
+
+	seen := make(map[int64]bool)
+
+	for parent, ok := parents[id]; ok && !seen[parent]; parent, ok = parents[parent] {
+		delete(w.collapsed, parent)
+		seen[parent] = true
+	}
+
+	w.rebuild()
+}
+
 func (w *tasksWidget) Current() int {
 	return w.base.Current()
 }
@@ -76,6 +443,14 @@ func (w *tasksWidget) SetTaskAt(idx int, task *store.Task) {
 	if len(w.model) > 0 && idx < len(w.model) {
 		w.model[idx] = *task
 	}
+
+	if w.tree {
+		for i := range w.tasks {
+			if w.tasks[i].ID == task.ID {
+				w.tasks[i] = *task
+			}
+		}
+	}
 }
 
 func (w *tasksWidget) render() {
@@ -91,48 +466,171 @@ func (w *tasksWidget) render() {
 				fmt.Fprintf(view, "\n")
 			}
 
-			ts := ""
-			age := now.Sub(task.UpdatedAt)
-
-			if age > 365*24*time.Hour {
-				ts = task.UpdatedAt.Local().Format("06 Jan")
-			} else if age > 6*24*time.Hour {
-				ts = task.UpdatedAt.Local().Format("Jan 02")
-			} else if age > 23*time.Hour {
-				ts = task.UpdatedAt.Local().Format("Mon   ")
-			} else {
-				ts = task.UpdatedAt.Local().Format("15:04 ")
-			}
+			ts := fmt.Sprintf("%-6s", formatAge(task.UpdatedAt, now))
 
+			t := conf.theme
 			prefix := "  "
 			color := ""
-			reset := "\033[0m"
-			//color = "\033[0;37m"
+			reset := ansiReset
 
 			if task.ClockinAt != nil {
-				color = "\033[1m"
+				color = t.style("active")
 				prefix = "A "
 			} else if task.ArchivedAt != nil {
-				// color = "\033[9m"
-				// color = "\033[34m"
-				color = "\033[38;5;240m"
+				color = t.style("archived")
 				prefix = "X "
 			}
 
+			if w.marked[task.ID] {
+				color += t.style("marked")
+				prefix = prefix[:1] + "*"
+			}
+
 			state := ""
 			if task.State != nil {
-				idx := getStateIndex(*task.State)
-				if idx >= 0 {
-					state = todoColors[idx] + *task.State + reset + " "
+				state = t.stateStyle(task.Project, *task.State) + *task.State + reset + color + " "
+			}
+
+			estimate := ""
+			if task.Estimate != nil {
+				spent := time.Duration(task.Spent) * time.Second
+				limit := time.Duration(*task.Estimate) * time.Second
+				estimate = formatDuration(spent) + "/" + formatDuration(limit)
+				if spent > limit {
+					if t.mono {
+						estimate += "!"
+					}
+					estimate = t.style("overdue") + estimate + reset + color
+				}
+				estimate += " "
+			}
+
+			tree := ""
+			rollup := ""
+
+			if w.tree {
+				tree = strings.Repeat("  ", w.depths[i])
+				if w.children[task.ID] == 0 {
+					tree += "  "
+				} else if w.collapsed[task.ID] {
+					tree += "▸ "
+				} else {
+					tree += "▾ "
+				}
+
+				if task.Descendants > 0 {
+					rollup = fmt.Sprintf(" [%d]", task.Descendants)
+				}
+			}
+
+			spent := task.Spent
+			if w.rangeSpent {
+				spent = task.RangeSpent
+			}
+
+			column := ""
+			if spent > 0 {
+				column = formatDuration(time.Duration(spent) * time.Second)
+			}
+
+			line := color + prefix + ts + " " + tree + state + estimate
+			title := task.Title
+			positions := w.matches[task.ID]
+
+			// The spent column is right-aligned unless the view is too narrow.
+			width := sx
+			if sx >= spentColumnWidth+20 {
+				width = sx - spentColumnWidth
+				column = fmt.Sprintf(" %*s", spentColumnWidth-1, column)
+				title = truncateWidth(title, width-displayWidth(line)-xui.StringWidth(rollup))
+			} else if column != "" {
+				column = " " + column
+			}
+
+			if len(positions) > 0 {
+				n := utf8.RuneCountInString(title)
+				if title != task.Title {
+					// Don't highlight the ellipsis.
+					n--
 				}
+				title = highlight(title, positions, n, t.style("match"), reset+color)
 			}
 
-			line := color + prefix + ts + " " + state + _escape(task.Title) + reset
-			fmt.Fprintf(view, xui.Pad(line, sx))
+			line = xui.Pad(line+title+rollup, width) + column + reset
+			fmt.Fprintf(view, _escape(line))
 		}
 	}
 }
 
+// spentColumnWidth is the width of the spent column in the task list,
+// including the space that separates it from the title.
+const spentColumnWidth = 7
+
+var reEscapeSeq = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// displayWidth returns the width of s without ANSI escape sequences.
+func displayWidth(s string) int {
+	return xui.StringWidth(reEscapeSeq.ReplaceAllString(s, ""))
+}
+
+// truncateWidth shortens s to at most width columns, ending it with an
+// ellipsis if anything was cut.
+func truncateWidth(s string, width int) string {
+	if xui.StringWidth(s) <= width {
+		return s
+	}
+
+	if width < 1 {
+		return ""
+	}
+
+	runes := []rune(s)
+	for len(runes) > 0 && xui.StringWidth(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+
+	return string(runes) + "…"
+}
+
+// highlight wraps the runes of s at positions below n in on and off.
+func highlight(s string, positions []int, n int, on, off string) string {
+	set := make(map[int]bool, len(positions))
+	for _, pos := range positions {
+		if pos < n {
+			set[pos] = true
+		}
+	}
+
+	var b strings.Builder
+
+	for i, ch := range []rune(s) {
+		if set[i] {
+			b.WriteString(on)
+			b.WriteRune(ch)
+			b.WriteString(off)
+		} else {
+			b.WriteRune(ch)
+		}
+	}
+
+	return b.String()
+}
+
+// formatAge formats t with less detail the longer ago it was.
+func formatAge(t, now time.Time) string {
+	age := now.Sub(t)
+
+	if age > 365*24*time.Hour {
+		return t.Local().Format(conf.Formats.Year)
+	} else if age > 6*24*time.Hour {
+		return t.Local().Format(conf.Formats.Date)
+	} else if age > 23*time.Hour {
+		return t.Local().Format(conf.Formats.Weekday)
+	}
+
+	return t.Local().Format(conf.Formats.Time)
+}
+
 func _escape(s string) string {
 	return strings.ReplaceAll(s, "%", "%%")
 }
@@ -153,6 +651,7 @@ func (w *timesheetWidget) View() *gocui.View {
 func (w *timesheetWidget) SetView(view *gocui.View) {
 	w.base.Highlight = true
 	w.base.SetView(view)
+	conf.theme.setSelectionStyle(view)
 }
 
 func (w *timesheetWidget) Model() []store.TimesheetEntry {
@@ -161,19 +660,23 @@ func (w *timesheetWidget) Model() []store.TimesheetEntry {
 
 func (w *timesheetWidget) SetModel(entries []store.TimesheetEntry) {
 	w.entries = entries
+	w.base.SetModel(formatTimesheet(entries))
+}
 
+// formatTimesheet formats timesheet entries followed by a per-project summary.
+func formatTimesheet(entries []store.TimesheetEntry) []string {
 	lines := make([]string, 0)
 	m := make(map[string]time.Duration, 0)
 	var total time.Duration
 
 	for _, e := range entries {
-		day := e.ClockinAt.Local().Format("Jan 02 Mon")
-		start := e.ClockinAt.Local().Format("15:04")
+		day := e.ClockinAt.Local().Format(conf.Formats.Day)
+		start := e.ClockinAt.Local().Format(conf.Formats.Time)
 		end := ""
 		diff := ""
 
 		if e.ClockoutAt != nil {
-			end = e.ClockoutAt.Local().Format("15:04")
+			end = e.ClockoutAt.Local().Format(conf.Formats.Time)
 			delta := e.ClockoutAt.Sub(e.ClockinAt)
 			diff = formatDuration(delta)
 			m[e.Project] += delta
@@ -207,7 +710,7 @@ func (w *timesheetWidget) SetModel(entries []store.TimesheetEntry) {
 		lines = append(lines, line)
 	}
 
-	w.base.SetModel(lines)
+	return lines
 }
 
 func (w *timesheetWidget) Current() int {
@@ -239,3 +742,190 @@ func formatDuration(d time.Duration) string {
 
 	return fmt.Sprintf("%02d:%02d", hour, min)
 }
+
+// parseDuration parses a duration either in HH:MM format or as accepted by
+// time.ParseDuration, e.g. "1h30m". Negative durations are rejected.
+func parseDuration(s string) (time.Duration, error) {
+	if i := strings.IndexByte(s, ':'); i >= 0 {
+		h, herr := strconv.ParseUint(s[:i], 10, 16)
+		m, merr := strconv.ParseUint(s[i+1:], 10, 8)
+		if herr != nil || merr != nil || m > 59 {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, nil
+}
+
+// previewWidget shows the body and metadata of a task.
+type previewWidget struct {
+	view   *gocui.View
+	lines  []string
+	offset int
+}
+
+func (w *previewWidget) View() *gocui.View {
+	return w.view
+}
+
+func (w *previewWidget) SetView(view *gocui.View) {
+	if view != nil {
+		view.Wrap = false
+	}
+	w.view = view
+	w.render()
+}
+
+// SetModel replaces the shown lines and scrolls to the top.
+func (w *previewWidget) SetModel(lines []string) {
+	w.lines = lines
+	w.offset = 0
+	w.render()
+}
+
+// ScrollPage scrolls half a page down, or up if dir is negative.
+func (w *previewWidget) ScrollPage(dir int) {
+	if w.view == nil {
+		return
+	}
+
+	sx, sy := w.view.Size()
+	delta := (sy + 1) / 2
+
+	if dir < 0 {
+		delta = -delta
+	}
+
+	max := len(wrapLines(w.lines, sx-2)) - sy
+	w.offset += delta
+
+	if w.offset > max {
+		w.offset = max
+	}
+
+	if w.offset < 0 {
+		w.offset = 0
+	}
+
+	w.render()
+}
+
+func (w *previewWidget) render() {
+	view := w.view
+
+	if view != nil {
+		view.Clear()
+		sx, sy := view.Size()
+		lines := wrapLines(w.lines, sx-2)
+
+		for i := 0; i < sy; i++ {
+			line := ""
+			if w.offset+i < len(lines) {
+				line = lines[w.offset+i]
+			}
+			if i > 0 {
+				fmt.Fprintf(view, "\n")
+			}
+			fmt.Fprint(view, "│ "+line)
+		}
+	}
+}
+
+// wrapLines breaks lines longer than width at spaces, or anywhere if a word
+// doesn't fit.
+func wrapLines(lines []string, width int) []string {
+	if width < 1 {
+		return lines
+	}
+
+	wrapped := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		line = strings.TrimRight(strings.Replace(line, "\t", "    ", -1), " ")
+
+		for xui.StringWidth(line) > width {
+			runes := []rune(line)
+			cut := width
+			if cut > len(runes) {
+				cut = len(runes)
+			}
+			if space := strings.LastIndex(string(runes[:cut]), " "); space > 0 {
+				cut = len([]rune(line[:space]))
+			}
+			wrapped = append(wrapped, string(runes[:cut]))
+			line = strings.TrimLeft(string(runes[cut:]), " ")
+		}
+
+		wrapped = append(wrapped, line)
+	}
+
+	return wrapped
+}
+
+// formatPreview returns the lines shown in the preview pane for task.
+func formatPreview(task *store.Task, parent *store.Task) []string {
+	timestamp := func(t time.Time) string {
+		return t.Local().Format(conf.Formats.Timestamp)
+	}
+
+	lines := []string{fmt.Sprintf("#%d %s", task.ID, task.Title), ""}
+
+	field := func(name, value string) {
+		lines = append(lines, fmt.Sprintf("%-10s %s", name+":", value))
+	}
+
+	if task.Project != "" {
+		field("Project", task.Project)
+	}
+
+	if task.State != nil {
+		field("State", *task.State)
+	}
+
+	field("Created", timestamp(task.CreatedAt))
+	field("Updated", timestamp(task.UpdatedAt))
+
+	if task.ScheduledAt != nil {
+		field("Scheduled", timestamp(*task.ScheduledAt))
+	}
+
+	spent := formatDuration(time.Duration(task.Spent) * time.Second)
+	if task.Estimate != nil {
+		spent += " of " + formatDuration(time.Duration(*task.Estimate)*time.Second)
+	}
+	field("Spent", spent)
+
+	if parent != nil {
+		field("Parent", fmt.Sprintf("#%d %s", parent.ID, parent.Title))
+	}
+
+	if task.ClockinAt != nil {
+		field("Clocked in", timestamp(*task.ClockinAt))
+	}
+
+	if task.ArchivedAt != nil {
+		field("Archived", timestamp(*task.ArchivedAt))
+	}
+
+	lines = append(lines, "")
+
+	body := strings.Split(strings.TrimRight(task.Body, "\n"), "\n")
+
+	// The first line is the title, which is already shown.
+	if len(body) > 0 && strings.TrimSpace(body[0]) == task.Title {
+		body = body[1:]
+	}
+
+	for len(body) > 0 && strings.TrimSpace(body[0]) == "" {
+		body = body[1:]
+	}
+
+	return append(lines, body...)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDuration(t *testing.T) {
+	valid := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"1:30", 90 * time.Minute},
+		{"0:05", 5 * time.Minute},
+		{"12:00", 12 * time.Hour},
+		{"1h30m", 90 * time.Minute},
+		{"45m", 45 * time.Minute},
+		{"0s", 0},
+	}
+	for _, tc := range valid {
+		d, err := parseDuration(tc.in)
+		require.Nil(t, err, tc.in)
+		require.Equal(t, tc.want, d, tc.in)
+	}
+
+	invalid := []string{
+		"",
+		"1:30abc",
+		"1:30 ",
+		"abc1:30",
+		"1:",
+		":30",
+		"1:60",
+		"1:99",
+		"-1:30",
+		"1:-30",
+		"+1:30",
+		"-1h",
+		"-30m",
+		"1h30",
+	}
+	for _, in := range invalid {
+		_, err := parseDuration(in)
+		require.NotNil(t, err, in)
+	}
+}